@@ -0,0 +1,212 @@
+package activitypub
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ContentType is what ActivityPub documents are served and posted as
+	ContentType = "application/activity+json"
+	// Context is the JSON-LD context of ActivityStreams documents
+	Context = "https://www.w3.org/ns/activitystreams"
+	// Public is the collection that addresses an activity to everyone
+	Public = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+// accept asks for an ActivityStreams document in either of its media types
+const accept = `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+// maxDocument is how much of a fetched document is read
+const maxDocument = 1 << 20
+
+// Actor is the part of a remote actor document we use
+type Actor struct {
+	ID                string    `json:"id"`
+	Type              string    `json:"type"`
+	PreferredUsername string    `json:"preferredUsername"`
+	Name              string    `json:"name"`
+	URL               any       `json:"url"`
+	Inbox             string    `json:"inbox"`
+	Endpoints         Endpoints `json:"endpoints"`
+	PublicKey         PublicKey `json:"publicKey"`
+}
+
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// DeliveryInbox is where activities for this actor go, preferring the shared
+// inbox of its server so a server hosting many followers gets one copy
+func (a *Actor) DeliveryInbox() string {
+	if a.Endpoints.SharedInbox != "" {
+		return a.Endpoints.SharedInbox
+	}
+	return a.Inbox
+}
+
+// ProfileURL is the actor's web page, falling back to its id
+func (a *Actor) ProfileURL() string {
+	switch url := a.URL.(type) {
+	case string:
+		return url
+	case map[string]any:
+		if href, ok := url["href"].(string); ok {
+			return href
+		}
+	}
+	return a.ID
+}
+
+// Activity is an incoming activity. Object is kept raw as it is either an id
+// or an embedded object, depending on the activity and the sender.
+type Activity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Object is the part of an embedded object we use
+type Object struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Actor        string `json:"actor"`
+	Object       any    `json:"object"`
+	AttributedTo string `json:"attributedTo"`
+	InReplyTo    string `json:"inReplyTo"`
+	Content      string `json:"content"`
+	URL          any    `json:"url"`
+}
+
+// ObjectID is the id of the activity's object, embedded or not
+func (a Activity) ObjectID() string {
+	var id string
+	if json.Unmarshal(a.Object, &id) == nil {
+		return id
+	}
+	var obj Object
+	json.Unmarshal(a.Object, &obj)
+	return obj.ID
+}
+
+// EmbeddedObject is the activity's object when it was sent whole
+func (a Activity) EmbeddedObject() (Object, bool) {
+	var obj Object
+	if err := json.Unmarshal(a.Object, &obj); err != nil || obj.ID == "" {
+		return Object{}, false
+	}
+	return obj, true
+}
+
+// FetchActor loads the actor document at id, signing the request so servers
+// that only answer signed fetches talk to us. A key id works too, as it is
+// the actor's id with a fragment.
+func FetchActor(client *http.Client, id string, sign func(*http.Request) error) (*Actor, error) {
+	id, _, _ = strings.Cut(id, "#")
+
+	req, err := http.NewRequest(http.MethodGet, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "RustyBits ActivityPub")
+	if sign != nil {
+		if err := sign(req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetching %s: %s", id, resp.Status)
+	}
+
+	var actor Actor
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocument)).Decode(&actor); err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", id, err)
+	}
+	if actor.ID == "" || actor.Inbox == "" || actor.PublicKey.PublicKeyPem == "" {
+		return nil, fmt.Errorf("%s is not an actor", id)
+	}
+	return &actor, nil
+}
+
+// GenerateKey makes a new private key for an actor, PEM encoded
+func GenerateKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func ParsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM data in private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// PublicKeyPEM is the public half of key, as published in the actor document
+func PublicKeyPEM(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+func ParsePublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM data in public key")
+	}
+
+	var key any
+	var err error
+	if block.Type == "RSA PUBLIC KEY" {
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,155 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxClockSkew is how far the Date of a signed request may be from now
+const maxClockSkew = 12 * time.Hour
+
+var (
+	ErrUnsigned     = errors.New("request is not signed")
+	ErrBadSignature = errors.New("signature does not verify")
+)
+
+// Sign adds an HTTP signature to req, as Mastodon and most of the fediverse
+// expect: rsa-sha256 over the request target, host, date and, when there is a
+// body, its digest
+func Sign(req *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		sum := sha256.Sum256(body)
+		req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+		headers = append(headers, "digest")
+	}
+
+	hash := sha256.Sum256([]byte(signingString(req, headers)))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// Verify checks the HTTP signature of req and returns the id of the key that
+// signed it. lookup resolves a key id to its public key. A request with a
+// body must sign its digest, and the digest must match the body.
+func Verify(req *http.Request, body []byte, lookup func(keyID string) (*rsa.PublicKey, error)) (string, error) {
+	params := parseSignature(req.Header.Get("Signature"))
+	keyID, signature := params["keyId"], params["signature"]
+	if keyID == "" || signature == "" {
+		return "", ErrUnsigned
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	required := []string{"(request-target)", "host", "date"}
+	if len(body) > 0 {
+		required = append(required, "digest")
+	}
+	for _, name := range required {
+		if !contains(headers, name) {
+			return "", fmt.Errorf("%w: %s is not signed", ErrBadSignature, name)
+		}
+	}
+
+	date, err := http.ParseTime(req.Header.Get("Date"))
+	if err != nil || time.Since(date).Abs() > maxClockSkew {
+		return "", fmt.Errorf("%w: date is missing or too far off", ErrBadSignature)
+	}
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		if !strings.EqualFold(req.Header.Get("Digest"), "SHA-256="+base64.StdEncoding.EncodeToString(sum[:])) {
+			return "", fmt.Errorf("%w: digest does not match the body", ErrBadSignature)
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	key, err := lookup(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(signingString(req, headers)))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig); err != nil {
+		return "", ErrBadSignature
+	}
+	return keyID, nil
+}
+
+// Signature helpers
+
+func signingString(req *http.Request, headers []string) string {
+	lines := make([]string, len(headers))
+	for i, name := range headers {
+		var value string
+		switch name {
+		case "(request-target)":
+			value = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			value = req.Host
+		default:
+			value = strings.Join(req.Header.Values(name), ", ")
+		}
+		lines[i] = name + ": " + value
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSignature splits a Signature header into its quoted parameters
+func parseSignature(header string) map[string]string {
+	params := make(map[string]string)
+	for header != "" {
+		key, rest, ok := strings.Cut(header, "=")
+		if !ok {
+			break
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimSpace(rest)
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[key] = value
+		header = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return params
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
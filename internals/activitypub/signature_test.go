@@ -0,0 +1,137 @@
+package activitypub
+
+import (
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKeyID = "https://social.example/users/alice#main-key"
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	data, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// lookupKey resolves testKeyID to key the way an inbox would, by fetching
+// the actor and reading its published key
+func lookupKey(key *rsa.PrivateKey) func(string) (*rsa.PublicKey, error) {
+	return func(keyID string) (*rsa.PublicKey, error) {
+		if keyID != testKeyID {
+			return nil, errors.New("unknown key " + keyID)
+		}
+		published, err := PublicKeyPEM(key)
+		if err != nil {
+			return nil, err
+		}
+		return ParsePublicKey(published)
+	}
+}
+
+func signedRequest(t *testing.T, key *rsa.PrivateKey, body []byte) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "https://blog.example/ap/inbox?x=1", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Sign(req, body, testKeyID, key); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSignVerify(t *testing.T) {
+	key := testKey(t)
+	body := []byte(`{"type":"Follow"}`)
+
+	req := signedRequest(t, key, body)
+	signature := parseSignature(req.Header.Get("Signature"))
+	if signature["keyId"] != testKeyID || signature["algorithm"] != "rsa-sha256" {
+		t.Errorf("signature parameters = %v", signature)
+	}
+	if signature["headers"] != "(request-target) host date digest" {
+		t.Errorf("signed headers = %q", signature["headers"])
+	}
+
+	keyID, err := Verify(req, body, lookupKey(key))
+	if err != nil || keyID != testKeyID {
+		t.Fatalf("Verify = %q, %v", keyID, err)
+	}
+
+	// a signed GET has no digest to sign
+	get, _ := http.NewRequest(http.MethodGet, "https://social.example/users/alice", nil)
+	if err := Sign(get, nil, testKeyID, key); err != nil {
+		t.Fatal(err)
+	}
+	if get.Header.Get("Digest") != "" {
+		t.Error("a request without a body got a digest")
+	}
+	if _, err := Verify(get, nil, lookupKey(key)); err != nil {
+		t.Errorf("Verify of a signed GET = %v", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	key := testKey(t)
+	body := []byte(`{"type":"Follow"}`)
+
+	tests := []struct {
+		name   string
+		tamper func(req *http.Request) []byte
+		want   error
+	}{
+		{"unsigned", func(req *http.Request) []byte {
+			req.Header.Del("Signature")
+			return body
+		}, ErrUnsigned},
+		{"changed body", func(req *http.Request) []byte {
+			return []byte(`{"type":"Delete"}`)
+		}, ErrBadSignature},
+		{"changed body and digest", func(req *http.Request) []byte {
+			other := []byte(`{"type":"Delete"}`)
+			req.Header.Set("Digest", signedRequest(t, key, other).Header.Get("Digest"))
+			return other
+		}, ErrBadSignature},
+		{"other target", func(req *http.Request) []byte {
+			req.URL.Path = "/ap/outbox"
+			return body
+		}, ErrBadSignature},
+		{"other host", func(req *http.Request) []byte {
+			req.Host = "evil.example"
+			return body
+		}, ErrBadSignature},
+		{"stale date", func(req *http.Request) []byte {
+			req.Header.Set("Date", time.Now().Add(-13*time.Hour).UTC().Format(http.TimeFormat))
+			return body
+		}, ErrBadSignature},
+		{"digest not signed", func(req *http.Request) []byte {
+			req.Header.Set("Signature", strings.Replace(req.Header.Get("Signature"), " digest", "", 1))
+			return body
+		}, ErrBadSignature},
+		{"signed by another key", func(req *http.Request) []byte {
+			req.Header.Set("Signature", signedRequest(t, testKey(t), body).Header.Get("Signature"))
+			return body
+		}, ErrBadSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest(t, key, body)
+			sent := tt.tamper(req)
+			if _, err := Verify(req, sent, lookupKey(key)); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
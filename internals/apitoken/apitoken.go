@@ -0,0 +1,60 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Scopes a token can be granted, named as in the Micropub spec
+const (
+	ScopeCreate = "create"
+	ScopeUpdate = "update"
+	ScopeDelete = "delete"
+	ScopeMedia  = "media"
+)
+
+// Scopes lists every scope, in the order the admin shows them
+var Scopes = []string{ScopeCreate, ScopeUpdate, ScopeDelete, ScopeMedia}
+
+// Generate makes a new token and the hash it is stored under
+func Generate() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(buf)
+	return token, Hash(token), nil
+}
+
+// Hash is what a token is looked up by. Tokens are random, so a plain hash
+// is enough to keep a copy of the database from being usable to post.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasScope reports whether the space separated scope list grants want
+func HasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize keeps the known scopes of the requested ones, without duplicates
+func Normalize(requested []string) string {
+	var granted []string
+	for _, s := range Scopes {
+		for _, r := range requested {
+			if HasScope(r, s) {
+				granted = append(granted, s)
+				break
+			}
+		}
+	}
+	return strings.Join(granted, " ")
+}
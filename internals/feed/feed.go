@@ -0,0 +1,362 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Feed is a format independent description of a feed. Every url in it must
+// be absolute.
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the html page the feed mirrors, FeedURL the address of the feed itself
+	Link    string
+	FeedURL string
+	// Hub is the WebSub hub subscribers are pointed at, if any
+	Hub     string
+	Author  string
+	Updated time.Time
+	Items   []Item
+}
+
+// Item is one entry. Content holds the full html and may be empty when only
+// the summary is published.
+type Item struct {
+	ID         string
+	Title      string
+	Link       string
+	Summary    string
+	Content    string
+	Author     string
+	Image      string
+	Published  time.Time
+	Updated    time.Time
+	Categories []string
+}
+
+// LastModified is the newest update among the feed and its items
+func (f Feed) LastModified() time.Time {
+	latest := f.Updated
+	for _, item := range f.Items {
+		if item.Updated.After(latest) {
+			latest = item.Updated
+		}
+		if item.Published.After(latest) {
+			latest = item.Published
+		}
+	}
+	return latest
+}
+
+// id is the feed's permanent id, its url without the query. The same feed
+// is served in several formats and with or without full content, and an
+// Atom id must not change with the way the feed was asked for.
+func (f Feed) id() string {
+	u, err := url.Parse(f.FeedURL)
+	if err != nil {
+		return f.FeedURL
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// Atom 1.0, RFC 4287
+
+const atomNS = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Author   *atomPerson `xml:"author,omitempty"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	Title      atomText       `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+// Atom renders the feed as an Atom 1.0 document
+func (f Feed) Atom() ([]byte, error) {
+	doc := atomFeed{
+		XMLNS:    atomNS,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       f.id(),
+		Updated:  atomDate(f.LastModified()),
+		Links: []atomLink{
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+			{Rel: "self", Type: "application/atom+xml", Href: f.FeedURL},
+		},
+	}
+	if f.Hub != "" {
+		doc.Links = append(doc.Links, atomLink{Rel: "hub", Href: f.Hub})
+	}
+	if f.Author != "" {
+		doc.Author = &atomPerson{Name: f.Author}
+	}
+
+	for _, item := range f.Items {
+		entry := atomEntry{
+			Title:     atomText{Type: "text", Body: item.Title},
+			ID:        item.ID,
+			Published: atomDate(item.Published),
+			Updated:   atomDate(latest(item.Updated, item.Published)),
+			Links:     []atomLink{{Rel: "alternate", Type: "text/html", Href: item.Link}},
+		}
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author}
+		}
+		if item.Image != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Type: imageType(item.Image), Href: item.Image})
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category})
+		}
+		if item.Summary != "" {
+			entry.Summary = &atomText{Type: "text", Body: item.Summary}
+		}
+		if item.Content != "" {
+			entry.Content = &atomText{Type: "html", Body: item.Content}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return marshalXML(doc)
+}
+
+func atomDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// RSS 2.0, https://www.rssboard.org/rss-specification
+
+type rssDocument struct {
+	XMLName      xml.Name   `xml:"rss"`
+	Version      string     `xml:"version,attr"`
+	XMLNSAtom    string     `xml:"xmlns:atom,attr"`
+	XMLNSContent string     `xml:"xmlns:content,attr"`
+	XMLNSDC      string     `xml:"xmlns:dc,attr"`
+	Channel      rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate,omitempty"`
+	AtomLinks     []atomLink `xml:"atom:link"`
+	Items         []rssItem  `xml:"item"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description,omitempty"`
+	Content     *cdata   `xml:"content:encoded,omitempty"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type cdata struct {
+	Body string `xml:",cdata"`
+}
+
+// RSS renders the feed as an RSS 2.0 document. Items carry their summary as
+// description and the full html, when there is any, as content:encoded.
+func (f Feed) RSS() ([]byte, error) {
+	doc := rssDocument{
+		Version:      "2.0",
+		XMLNSAtom:    atomNS,
+		XMLNSContent: "http://purl.org/rss/1.0/modules/content/",
+		XMLNSDC:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title: f.Title,
+			Link:  f.Link,
+			// description is required, even if the site has no tagline
+			Description: f.Description,
+			AtomLinks:   []atomLink{{Rel: "self", Type: "application/rss+xml", Href: f.FeedURL}},
+		},
+	}
+	if f.Hub != "" {
+		doc.Channel.AtomLinks = append(doc.Channel.AtomLinks, atomLink{Rel: "hub", Href: f.Hub})
+	}
+	if doc.Channel.Description == "" {
+		doc.Channel.Description = f.Title
+	}
+	if updated := f.LastModified(); !updated.IsZero() {
+		doc.Channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for _, item := range f.Items {
+		entry := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Summary,
+			Creator:     item.Author,
+			Categories:  item.Categories,
+			GUID:        rssGUID{IsPermaLink: item.ID == item.Link, Value: item.ID},
+			PubDate:     item.Published.Format(time.RFC1123Z),
+		}
+		if item.Content != "" {
+			entry.Content = &cdata{Body: item.Content}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, entry)
+	}
+
+	return marshalXML(doc)
+}
+
+// JSON Feed 1.1, https://www.jsonfeed.org/version/1.1/
+
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type jsonFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url,omitempty"`
+	FeedURL     string       `json:"feed_url,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Authors     []jsonAuthor `json:"authors,omitempty"`
+	Hubs        []jsonHub    `json:"hubs,omitempty"`
+	Items       []jsonItem   `json:"items"`
+}
+
+type jsonHub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url,omitempty"`
+	Title         string       `json:"title,omitempty"`
+	ContentHTML   string       `json:"content_html,omitempty"`
+	ContentText   string       `json:"content_text,omitempty"`
+	Summary       string       `json:"summary,omitempty"`
+	Image         string       `json:"image,omitempty"`
+	DatePublished string       `json:"date_published,omitempty"`
+	DateModified  string       `json:"date_modified,omitempty"`
+	Authors       []jsonAuthor `json:"authors,omitempty"`
+	Tags          []string     `json:"tags,omitempty"`
+}
+
+// JSON renders the feed as a JSON Feed 1.1 document
+func (f Feed) JSON() ([]byte, error) {
+	doc := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.FeedURL,
+		Description: f.Description,
+		Items:       []jsonItem{},
+	}
+	if f.Author != "" {
+		doc.Authors = []jsonAuthor{{Name: f.Author}}
+	}
+	if f.Hub != "" {
+		doc.Hubs = []jsonHub{{Type: "WebSub", URL: f.Hub}}
+	}
+
+	for _, item := range f.Items {
+		entry := jsonItem{
+			ID:            item.ID,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			Summary:       item.Summary,
+			Image:         item.Image,
+			DatePublished: atomDate(item.Published),
+			DateModified:  atomDate(latest(item.Updated, item.Published)),
+			Tags:          item.Categories,
+		}
+		// an item needs content of some kind, fall back to the summary as text
+		if entry.ContentHTML == "" {
+			entry.ContentText = item.Summary
+		}
+		if item.Author != "" {
+			entry.Authors = []jsonAuthor{{Name: item.Author}}
+		}
+		doc.Items = append(doc.Items, entry)
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// Feed helpers
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// imageType guesses the type of an image enclosure from its extension
+func imageType(url string) string {
+	switch {
+	case strings.HasSuffix(url, ".png"):
+		return "image/png"
+	case strings.HasSuffix(url, ".gif"):
+		return "image/gif"
+	case strings.HasSuffix(url, ".webp"):
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}
+
+func marshalXML(v any) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
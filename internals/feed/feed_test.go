@@ -0,0 +1,198 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var testZone = time.FixedZone("CEST", 2*60*60)
+
+func testFeed() Feed {
+	return Feed{
+		Title:       "Rusty & Bits",
+		Description: `Notes on <Go> & "the web"`,
+		Link:        "https://blog.example/",
+		FeedURL:     "https://blog.example/feed.xml",
+		Hub:         "https://hub.example/",
+		Author:      "Ada",
+		Updated:     time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC),
+		Items: []Item{
+			{
+				ID:         "https://blog.example/posts/fish-chips",
+				Title:      "Fish & Chips <3",
+				Link:       "https://blog.example/posts/fish-chips",
+				Summary:    `Why "batter" & 'salt' matter`,
+				Content:    `<p>Crispy &amp; hot</p><pre>a]]>b</pre>`,
+				Author:     "Ada",
+				Published:  time.Date(2026, 3, 14, 18, 30, 5, 0, testZone),
+				Updated:    time.Date(2026, 3, 15, 8, 0, 0, 0, time.UTC),
+				Categories: []string{"Food & Drink", "uk"},
+			},
+			{
+				// posts whose slug changed keep the id they were first published with
+				ID:        "tag:blog.example,2026:post/7",
+				Title:     "Renamed",
+				Link:      "https://blog.example/posts/renamed-again",
+				Summary:   "Only a summary",
+				Published: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+}
+
+func TestRSSGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		feed Feed
+	}{
+		{"rss.xml", testFeed()},
+		{"rss-minimal.xml", Feed{
+			Title:   "Empty",
+			Link:    "https://blog.example/",
+			FeedURL: "https://blog.example/feed.xml",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.feed.RSS()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.name)
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("RSS() differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// TestRSSItems reads the rendered document back, so the golden file is known
+// to say what it should
+func TestRSSItems(t *testing.T) {
+	out, err := testFeed().RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Channel struct {
+			Title         string `xml:"title"`
+			Description   string `xml:"description"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title      string   `xml:"title"`
+				Link       string   `xml:"link"`
+				Content    string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+				Categories []string `xml:"category"`
+				PubDate    string   `xml:"pubDate"`
+				GUID       struct {
+					IsPermaLink string `xml:"isPermaLink,attr"`
+					Value       string `xml:",chardata"`
+				} `xml:"guid"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("output is not well-formed: %v", err)
+	}
+
+	channel := doc.Channel
+	if channel.Title != "Rusty & Bits" || channel.Description != `Notes on <Go> & "the web"` {
+		t.Errorf("channel text did not survive escaping: %q, %q", channel.Title, channel.Description)
+	}
+	if channel.LastBuildDate != "Sun, 15 Mar 2026 08:00:00 +0000" {
+		t.Errorf("lastBuildDate = %q", channel.LastBuildDate)
+	}
+	if len(channel.Items) != 2 {
+		t.Fatalf("got %d items", len(channel.Items))
+	}
+
+	first, second := channel.Items[0], channel.Items[1]
+	if first.Title != "Fish & Chips <3" {
+		t.Errorf("title = %q", first.Title)
+	}
+	if first.Content != `<p>Crispy &amp; hot</p><pre>a]]>b</pre>` {
+		t.Errorf("content:encoded = %q", first.Content)
+	}
+	if len(first.Categories) != 2 || first.Categories[0] != "Food & Drink" {
+		t.Errorf("categories = %q", first.Categories)
+	}
+
+	for _, item := range channel.Items {
+		u, err := url.Parse(item.Link)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			t.Errorf("item link %q is not absolute", item.Link)
+		}
+		if _, err := time.Parse(time.RFC1123Z, item.PubDate); err != nil {
+			t.Errorf("pubDate %q is not RFC 1123 with a numeric zone", item.PubDate)
+		}
+	}
+	if first.PubDate != "Sat, 14 Mar 2026 18:30:05 +0200" {
+		t.Errorf("pubDate = %q", first.PubDate)
+	}
+
+	if first.GUID.IsPermaLink != "true" || first.GUID.Value != first.Link {
+		t.Errorf("guid of a permalink = %+v", first.GUID)
+	}
+	if second.GUID.IsPermaLink != "false" || second.GUID.Value != "tag:blog.example,2026:post/7" {
+		t.Errorf("guid of a tag uri = %+v", second.GUID)
+	}
+}
+
+// the Atom id stays the same whatever format or content the feed was asked
+// for, while rel="self" keeps the address it was fetched at
+func TestAtomID(t *testing.T) {
+	var ids []string
+	for _, query := range []string{"", "?format=atom", "?format=atom&content=full"} {
+		f := testFeed()
+		f.FeedURL = "https://blog.example/tags/go/rss" + query
+
+		out, err := f.Atom()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			ID    string `xml:"id"`
+			Links []struct {
+				Rel  string `xml:"rel,attr"`
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		}
+		if err := xml.Unmarshal(out, &doc); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, doc.ID)
+
+		for _, link := range doc.Links {
+			if link.Rel == "self" && link.Href != f.FeedURL {
+				t.Errorf("self link = %q, want %q", link.Href, f.FeedURL)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if id != "https://blog.example/tags/go/rss" {
+			t.Errorf("atom ids = %q", ids)
+			break
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"RustyBits/internals/activitypub"
+	"RustyBits/internals/models"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxInboxBody caps the size of an activity posted to the inbox
+const maxInboxBody = 1 << 20
+
+// Activity types the blog sends
+const (
+	activityCreate = "Create"
+	activityUpdate = "Update"
+	activityDelete = "Delete"
+)
+
+// WebFinger resolves @username@host, the name the blog is followed by, to
+// the blog's actor
+func (h *Handler) WebFinger(c *gin.Context) {
+	site := h.Settings.Get()
+	resource := c.Query("resource")
+
+	base, err := url.Parse(site.BaseURL)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	account := "acct:" + site.ActivityPubUsername + "@" + base.Host
+	if !strings.EqualFold(resource, account) && resource != h.actorURL() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown resource"})
+		return
+	}
+
+	body, _ := json.Marshal(gin.H{
+		"subject": account,
+		"aliases": []string{h.actorURL(), site.URL("/")},
+		"links": []gin.H{
+			{"rel": "self", "type": activitypub.ContentType, "href": h.actorURL()},
+			{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": site.URL("/")},
+		},
+	})
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Data(http.StatusOK, "application/jrd+json; charset=utf-8", body)
+}
+
+// Actor serves the blog's actor document. Browsers are sent to the home page.
+func (h *Handler) Actor(c *gin.Context) {
+	if !wantsActivity(c) {
+		c.Redirect(http.StatusFound, "/")
+		return
+	}
+
+	publicKey, err := activitypub.PublicKeyPEM(h.ActorKey)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	site := h.Settings.Get()
+	h.activityJSON(c, http.StatusOK, gin.H{
+		"@context":                  []string{activitypub.Context, "https://w3id.org/security/v1"},
+		"id":                        h.actorURL(),
+		"type":                      "Person",
+		"preferredUsername":         site.ActivityPubUsername,
+		"name":                      site.Title,
+		"summary":                   site.Tagline,
+		"url":                       site.URL("/"),
+		"inbox":                     site.URL("/ap/inbox"),
+		"outbox":                    site.URL("/ap/outbox"),
+		"followers":                 site.URL("/ap/followers"),
+		"endpoints":                 gin.H{"sharedInbox": site.URL("/ap/inbox")},
+		"manuallyApprovesFollowers": false,
+		"discoverable":              true,
+		"publicKey": gin.H{
+			"id":           h.actorKeyID(),
+			"owner":        h.actorURL(),
+			"publicKeyPem": publicKey,
+		},
+	})
+}
+
+// Inbox takes activities from other servers. Every activity must be signed by
+// its actor. Follows are accepted straight away and replies to posts become
+// comments waiting for moderation.
+func (h *Handler) Inbox(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxInboxBody+1))
+	if err != nil || len(body) > maxInboxBody {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "activity is too large"})
+		return
+	}
+
+	var activity activitypub.Activity
+	if err := json.Unmarshal(body, &activity); err != nil || activity.Type == "" || activity.Actor == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not an activity"})
+		return
+	}
+
+	// servers announce deleted accounts to everyone they know, and a deleted
+	// account's key can no longer be fetched to check the signature
+	if activity.Type == activityDelete && activity.ObjectID() == activity.Actor {
+		var follower models.Follower
+		if h.DB.Where("actor_id = ?", activity.Actor).First(&follower).Error != nil {
+			c.Status(http.StatusAccepted)
+			return
+		}
+	}
+
+	var actor *activitypub.Actor
+	_, err = activitypub.Verify(c.Request, body, func(keyID string) (*rsa.PublicKey, error) {
+		actor, err = activitypub.FetchActor(h.FediClient, keyID, h.signFetch)
+		if err != nil {
+			return nil, err
+		}
+		if actor.PublicKey.ID != keyID {
+			return nil, fmt.Errorf("%s is not the key of %s", keyID, actor.ID)
+		}
+		return activitypub.ParsePublicKey(actor.PublicKey.PublicKeyPem)
+	})
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if actor.ID != activity.Actor {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "activity was signed by another actor"})
+		return
+	}
+
+	switch activity.Type {
+	case "Follow":
+		err = h.acceptFollow(actor, activity, body)
+	case "Undo":
+		if obj, ok := activity.EmbeddedObject(); ok && obj.Type == "Follow" && obj.Actor == actor.ID {
+			err = h.DB.Where("actor_id = ?", actor.ID).Delete(&models.Follower{}).Error
+		}
+	case activityCreate:
+		if obj, ok := activity.EmbeddedObject(); ok {
+			err = h.receiveReply(actor, obj)
+		}
+	case activityUpdate:
+		if obj, ok := activity.EmbeddedObject(); ok {
+			err = h.receiveEdit(actor, obj)
+		}
+	case activityDelete:
+		err = h.receiveDelete(actor, activity.ObjectID())
+	}
+
+	if err != nil {
+		log.Printf("Failed to handle %s activity from %s: %v", activity.Type, actor.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to handle activity"})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// Outbox lists the most recent posts as Create activities
+func (h *Handler) Outbox(c *gin.Context) {
+	site := h.Settings.Get()
+
+	var total int64
+	h.DB.Model(&models.Post{}).Where("published = ?", true).Count(&total)
+
+	var posts []models.Post
+	h.DB.Where("published = ?", true).
+		Preload("Tags").
+		Order("created_at DESC").
+		Limit(site.FeedLength).
+		Find(&posts)
+
+	items := make([]gin.H, 0, len(posts))
+	for _, post := range posts {
+		items = append(items, h.activity(activityCreate, post, h.apArticle(post)))
+	}
+
+	h.activityJSON(c, http.StatusOK, gin.H{
+		"@context":     activitypub.Context,
+		"id":           site.URL("/ap/outbox"),
+		"type":         "OrderedCollection",
+		"totalItems":   total,
+		"orderedItems": items,
+	})
+}
+
+// Followers shows how many followers the blog has, but not who they are
+func (h *Handler) Followers(c *gin.Context) {
+	var total int64
+	h.DB.Model(&models.Follower{}).Count(&total)
+
+	h.activityJSON(c, http.StatusOK, gin.H{
+		"@context":   activitypub.Context,
+		"id":         h.Settings.Get().URL("/ap/followers"),
+		"type":       "OrderedCollection",
+		"totalItems": total,
+	})
+}
+
+// Admin followers
+
+func (h *Handler) AdminFollowers(c *gin.Context) {
+	var followers []models.Follower
+	h.DB.Order("created_at DESC").Find(&followers)
+
+	site := h.Settings.Get()
+	base, _ := url.Parse(site.BaseURL)
+	handle := "@" + site.ActivityPubUsername
+	if base != nil {
+		handle += "@" + base.Host
+	}
+
+	h.render(c, http.StatusOK, "admin/followers.html", gin.H{
+		"followers": followers,
+		"handle":    handle,
+		"title":     "Followers",
+	})
+}
+
+// DeleteFollower stops delivering posts to a follower. Their server is not
+// told, so they can follow again.
+func (h *Handler) DeleteFollower(c *gin.Context) {
+	var follower models.Follower
+	if err := h.DB.First(&follower, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := h.DB.Delete(&follower).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "followerDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/followers")
+}
+
+// ActivityPub helpers
+
+func (h *Handler) actorURL() string {
+	return h.Settings.Get().URL("/ap/actor")
+}
+
+func (h *Handler) actorKeyID() string {
+	return h.actorURL() + "#main-key"
+}
+
+// signActivity signs deliveries to followers' inboxes
+func (h *Handler) signActivity(req *http.Request, body []byte) error {
+	return activitypub.Sign(req, body, h.actorKeyID(), h.ActorKey)
+}
+
+// signFetch signs requests for remote actors
+func (h *Handler) signFetch(req *http.Request) error {
+	return activitypub.Sign(req, nil, h.actorKeyID(), h.ActorKey)
+}
+
+// apArticle is a post as an ActivityStreams Article, its id the permalink
+func (h *Handler) apArticle(post models.Post) gin.H {
+	site := h.Settings.Get()
+	permalink := site.URL("/posts/" + post.Slug)
+
+	tags := make([]gin.H, 0, len(post.Tags))
+	for _, tag := range post.Tags {
+		tags = append(tags, gin.H{
+			"type": "Hashtag",
+			"name": "#" + strings.ReplaceAll(tag.Name, " ", ""),
+			"href": site.URL("/tags/" + url.PathEscape(tag.Name)),
+		})
+	}
+
+	article := gin.H{
+		"id":           permalink,
+		"type":         "Article",
+		"name":         post.Title,
+		"content":      post.Content,
+		"url":          permalink,
+		"attributedTo": h.actorURL(),
+		"published":    post.CreatedAt.UTC().Format(time.RFC3339),
+		"updated":      post.UpdatedAt.UTC().Format(time.RFC3339),
+		"to":           []string{activitypub.Public},
+		"cc":           []string{site.URL("/ap/followers")},
+		"tag":          tags,
+	}
+	if post.Excerpt != "" {
+		article["summary"] = post.Excerpt
+	}
+	return article
+}
+
+// activity wraps object in an activity by the blog, addressed like the post
+func (h *Handler) activity(kind string, post models.Post, object any) gin.H {
+	site := h.Settings.Get()
+	permalink := site.URL("/posts/" + post.Slug)
+
+	published := post.CreatedAt
+	if kind != activityCreate {
+		published = time.Now()
+	}
+
+	return gin.H{
+		"@context":  activitypub.Context,
+		"id":        fmt.Sprintf("%s#%s-%d", permalink, strings.ToLower(kind), published.Unix()),
+		"type":      kind,
+		"actor":     h.actorURL(),
+		"published": published.UTC().Format(time.RFC3339),
+		"to":        []string{activitypub.Public},
+		"cc":        []string{site.URL("/ap/followers")},
+		"object":    object,
+	}
+}
+
+// federate delivers a Create, Update or Delete of post to every follower
+func (h *Handler) federate(kind string, post models.Post) {
+	var inboxes []string
+	h.DB.Model(&models.Follower{}).Distinct("inbox").Pluck("inbox", &inboxes)
+	if len(inboxes) == 0 {
+		return
+	}
+
+	var object any
+	if kind == activityDelete {
+		object = gin.H{"id": h.Settings.Get().URL("/posts/" + post.Slug), "type": "Tombstone"}
+	} else {
+		if post.Tags == nil {
+			h.DB.Model(&post).Association("Tags").Find(&post.Tags)
+		}
+		object = h.apArticle(post)
+	}
+
+	payload, err := json.Marshal(h.activity(kind, post, object))
+	if err == nil {
+		err = h.Notifier.Deliver(inboxes, payload)
+	}
+	if err != nil {
+		log.Printf("Failed to queue %s of post %d for followers: %v", kind, post.ID, err)
+	}
+}
+
+// acceptFollow records a new follower and sends them an Accept
+func (h *Handler) acceptFollow(actor *activitypub.Actor, follow activitypub.Activity, raw []byte) error {
+	if follow.ObjectID() != h.actorURL() {
+		return nil
+	}
+
+	follower := models.Follower{
+		ActorID: actor.ID,
+		Inbox:   actor.DeliveryInbox(),
+		Handle:  actorHandle(actor),
+		Name:    actor.Name,
+		URL:     actor.ProfileURL(),
+	}
+	err := h.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "actor_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"inbox", "handle", "name", "url"}),
+	}).Create(&follower).Error
+	if err != nil {
+		return err
+	}
+
+	accept, err := json.Marshal(gin.H{
+		"@context": activitypub.Context,
+		"id":       fmt.Sprintf("%s#accept-%d", h.actorURL(), time.Now().UnixNano()),
+		"type":     "Accept",
+		"actor":    h.actorURL(),
+		"object":   json.RawMessage(raw),
+	})
+	if err != nil {
+		return err
+	}
+	return h.Notifier.Deliver([]string{actor.Inbox}, accept)
+}
+
+// receiveReply stores a note replying to a post, or to a reply to one, as a
+// comment waiting for moderation
+func (h *Handler) receiveReply(actor *activitypub.Actor, note activitypub.Object) error {
+	if note.Type != "Note" || note.InReplyTo == "" || note.AttributedTo != actor.ID || !sameOrigin(note.ID, actor.ID) {
+		return nil
+	}
+
+	var existing models.Comment
+	if h.DB.Where("remote_id = ?", note.ID).First(&existing).Error == nil {
+		return nil
+	}
+
+	comment := models.Comment{
+		Name:         firstNonEmpty(actor.Name, actorHandle(actor)),
+		Website:      actor.ProfileURL(),
+		Content:      plainText(note.Content, commentMaxLength),
+		Status:       models.CommentPending,
+		RemoteID:     note.ID,
+		RemoteAuthor: actor.ID,
+		UserAgent:    "ActivityPub",
+	}
+
+	var parent models.Comment
+	if post, ok := h.publishedPostByURL(note.InReplyTo); ok {
+		comment.PostID = post.ID
+	} else if h.DB.Where("remote_id = ?", note.InReplyTo).First(&parent).Error == nil {
+		comment.PostID = parent.PostID
+		comment.ParentID = &parent.ID
+	} else {
+		return nil
+	}
+
+	var post models.Post
+	if err := h.DB.First(&post, comment.PostID).Error; err != nil || !h.commentsOpen(post) {
+		return nil
+	}
+	if len(comment.Name) > commentNameMax {
+		comment.Name = comment.Name[:commentNameMax]
+	}
+	if err := h.validateComment(&comment); err != nil {
+		return nil
+	}
+	return h.DB.Create(&comment).Error
+}
+
+// receiveEdit changes the text of a reply. Only its author may edit it, and
+// an approved reply goes back to moderation, as the edit is new text nobody
+// has looked at.
+func (h *Handler) receiveEdit(actor *activitypub.Actor, note activitypub.Object) error {
+	content := plainText(note.Content, commentMaxLength)
+	if content == "" || !sameOrigin(note.ID, actor.ID) {
+		return nil
+	}
+
+	var comment models.Comment
+	err := h.DB.Where("remote_id = ? AND remote_author = ?", note.ID, actor.ID).First(&comment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if content == comment.Content {
+		return nil
+	}
+
+	updates := map[string]any{"content": content}
+	if comment.Status == models.CommentApproved {
+		updates["status"] = models.CommentPending
+	}
+	return h.DB.Model(&comment).Updates(updates).Error
+}
+
+// receiveDelete removes a deleted reply, or the follower whose account was deleted
+func (h *Handler) receiveDelete(actor *activitypub.Actor, id string) error {
+	if id == actor.ID {
+		return h.DB.Where("actor_id = ?", actor.ID).Delete(&models.Follower{}).Error
+	}
+	if !sameOrigin(id, actor.ID) {
+		return nil
+	}
+
+	var comment models.Comment
+	err := h.DB.Where("remote_id = ? AND remote_author = ?", id, actor.ID).First(&comment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return h.deleteComments([]uint{comment.ID})
+}
+
+// activityJSON writes an ActivityStreams document
+func (h *Handler) activityJSON(c *gin.Context, status int, doc gin.H) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, activitypub.ContentType+"; charset=utf-8", body)
+}
+
+// wantsActivity reports whether the client asked for ActivityStreams rather than html
+func wantsActivity(c *gin.Context) bool {
+	accept := c.GetHeader("Accept")
+	return strings.Contains(accept, "application/activity+json") ||
+		strings.Contains(accept, "application/ld+json")
+}
+
+func actorHandle(actor *activitypub.Actor) string {
+	u, err := url.Parse(actor.ID)
+	if err != nil || actor.PreferredUsername == "" {
+		return actor.ID
+	}
+	return "@" + actor.PreferredUsername + "@" + u.Host
+}
+
+// sameOrigin reports whether two ids are on the same server, so an actor can
+// only create, edit and delete objects on its own server
+func sameOrigin(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Host != "" && strings.EqualFold(ua.Host, ub.Host)
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"RustyBits/internals/activitypub"
+	"RustyBits/internals/models"
+	"RustyBits/internals/notify"
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeInstance is a fediverse server with two accounts, alice and bob. It
+// serves their actor documents and takes activities at their inboxes, checking
+// that everything the blog sends it is signed with the blog's key.
+type fakeInstance struct {
+	t       *testing.T
+	server  *httptest.Server
+	keys    map[string]*rsa.PrivateKey
+	blogKey *rsa.PublicKey
+
+	mu        sync.Mutex
+	delivered []deliveredActivity
+	errors    []string
+	arrived   chan struct{}
+}
+
+type deliveredActivity struct {
+	Path     string
+	Activity map[string]any
+}
+
+func newFakeInstance(t *testing.T, blogKey *rsa.PublicKey) *fakeInstance {
+	f := &fakeInstance{
+		t:       t,
+		keys:    map[string]*rsa.PrivateKey{"alice": newActorKey(t), "bob": newActorKey(t)},
+		blogKey: blogKey,
+		arrived: make(chan struct{}, 8),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func newActorKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	data, err := activitypub.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := activitypub.ParsePrivateKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (f *fakeInstance) actorID(name string) string { return f.server.URL + "/users/" + name }
+
+func (f *fakeInstance) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, err := activitypub.Verify(r, body, func(keyID string) (*rsa.PublicKey, error) {
+		if keyID != "https://blog.example/ap/actor#main-key" {
+			return nil, fmt.Errorf("unknown key %s", keyID)
+		}
+		return f.blogKey, nil
+	})
+	if err != nil {
+		f.errors = append(f.errors, fmt.Sprintf("%s %s: %v", r.Method, r.URL, err))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	name, isActor := strings.CutPrefix(r.URL.Path, "/users/")
+	key := f.keys[name]
+
+	switch {
+	case r.Method == http.MethodGet && isActor && key != nil:
+		publicKey, _ := activitypub.PublicKeyPEM(key)
+		w.Header().Set("Content-Type", activitypub.ContentType)
+		json.NewEncoder(w).Encode(gin.H{
+			"@context":          activitypub.Context,
+			"id":                f.actorID(name),
+			"type":              "Person",
+			"preferredUsername": name,
+			"name":              strings.ToUpper(name[:1]) + name[1:],
+			"url":               f.server.URL + "/@" + name,
+			"inbox":             f.actorID(name) + "/inbox",
+			"endpoints":         gin.H{"sharedInbox": f.server.URL + "/inbox"},
+			"publicKey": gin.H{
+				"id":           f.actorID(name) + "#main-key",
+				"owner":        f.actorID(name),
+				"publicKeyPem": publicKey,
+			},
+		})
+	case r.Method == http.MethodPost:
+		var activity map[string]any
+		if err := json.Unmarshal(body, &activity); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.delivered = append(f.delivered, deliveredActivity{Path: r.URL.Path, Activity: activity})
+		w.WriteHeader(http.StatusAccepted)
+		f.arrived <- struct{}{}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// inboxRequest posts activity to the blog's inbox, signed by key as keyID
+func inboxRequest(t *testing.T, activity any, keyID string, key *rsa.PrivateKey) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(activity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "https://blog.example/ap/inbox", bytes.NewReader(body))
+	req.Header.Set("Content-Type", activitypub.ContentType)
+	if key != nil {
+		if err := activitypub.Sign(req, body, keyID, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return req
+}
+
+func newFederatedHandler(t *testing.T) (*Handler, *fakeInstance, *gin.Engine) {
+	h := newTestHandler(t)
+	if err := h.DB.AutoMigrate(&models.Follower{}, &models.PingLog{}); err != nil {
+		t.Fatal(err)
+	}
+	h.ActorKey = newActorKey(t)
+
+	remote := newFakeInstance(t, &h.ActorKey.PublicKey)
+	h.FediClient = remote.server.Client()
+	h.Notifier = notify.New(h.DB, h.Settings)
+	h.Notifier.UntrustedClient = remote.server.Client()
+	h.Notifier.SignActivity = h.signActivity
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/ap/inbox", h.Inbox)
+	return h, remote, router
+}
+
+func TestFollowFromFakeInstance(t *testing.T) {
+	h, remote, router := newFederatedHandler(t)
+
+	follow := gin.H{
+		"@context": activitypub.Context,
+		"id":       remote.actorID("alice") + "#follows/1",
+		"type":     "Follow",
+		"actor":    remote.actorID("alice"),
+		"object":   "https://blog.example/ap/actor",
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, inboxRequest(t, follow, remote.actorID("alice")+"#main-key", remote.keys["alice"]))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("inbox answered %d: %s", w.Code, w.Body)
+	}
+
+	var follower models.Follower
+	if err := h.DB.Where("actor_id = ?", remote.actorID("alice")).First(&follower).Error; err != nil {
+		t.Fatalf("follower was not stored: %v", err)
+	}
+	host := remote.server.Listener.Addr().String()
+	if follower.Inbox != remote.server.URL+"/inbox" || follower.Handle != "@alice@"+host ||
+		follower.Name != "Alice" || follower.URL != remote.server.URL+"/@alice" {
+		t.Errorf("stored follower = %+v", follower)
+	}
+
+	h.Notifier.Start(1)
+	select {
+	case <-remote.arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Accept was never delivered")
+	}
+
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+	if len(remote.errors) > 0 {
+		t.Fatalf("the blog's requests failed verification: %v", remote.errors)
+	}
+	if len(remote.delivered) != 1 {
+		t.Fatalf("delivered %d activities", len(remote.delivered))
+	}
+	accept := remote.delivered[0]
+	if accept.Path != "/users/alice/inbox" {
+		t.Errorf("accept went to %s, not the follower's own inbox", accept.Path)
+	}
+	if accept.Activity["type"] != "Accept" || accept.Activity["actor"] != "https://blog.example/ap/actor" {
+		t.Errorf("accept = %v", accept.Activity)
+	}
+	object, _ := accept.Activity["object"].(map[string]any)
+	if object["id"] != follow["id"] || object["type"] != "Follow" || object["actor"] != remote.actorID("alice") {
+		t.Errorf("accept does not carry the follow: %v", accept.Activity["object"])
+	}
+}
+
+func TestInboxRejectsBadSignatures(t *testing.T) {
+	h, remote, router := newFederatedHandler(t)
+	keyID := remote.actorID("alice") + "#main-key"
+
+	follow := func(actor string) gin.H {
+		return gin.H{"id": actor + "#follows/1", "type": "Follow", "actor": actor, "object": "https://blog.example/ap/actor"}
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"unsigned", inboxRequest(t, follow(remote.actorID("alice")), "", nil)},
+		{"signed with another key", inboxRequest(t, follow(remote.actorID("alice")), keyID, newActorKey(t))},
+		{"body changed after signing", func() *http.Request {
+			req := inboxRequest(t, follow(remote.actorID("alice")), keyID, remote.keys["alice"])
+			body, _ := json.Marshal(follow(remote.actorID("alice") + "-impostor"))
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			return req
+		}()},
+		{"signed by an actor other than the sender", inboxRequest(t, follow(remote.actorID("bob")), keyID, remote.keys["alice"])},
+		{"key of an actor that is not there", inboxRequest(t, follow(remote.actorID("carol")), remote.actorID("carol")+"#main-key", remote.keys["alice"])},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tt.req)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("inbox answered %d, want 401: %s", w.Code, w.Body)
+			}
+		})
+	}
+
+	var count int64
+	h.DB.Model(&models.Follower{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d followers stored from rejected requests", count)
+	}
+	var pings int64
+	h.DB.Model(&models.PingLog{}).Count(&pings)
+	if pings != 0 {
+		t.Errorf("%d deliveries queued for rejected requests", pings)
+	}
+}
+
+// the blog signs its fetches too, for servers that only answer signed requests
+func TestSignedActorFetch(t *testing.T) {
+	h, remote, _ := newFederatedHandler(t)
+
+	actor, err := activitypub.FetchActor(h.FediClient, remote.actorID("alice")+"#main-key", h.signFetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actor.ID != remote.actorID("alice") || actor.DeliveryInbox() != remote.server.URL+"/inbox" {
+		t.Errorf("actor = %+v", actor)
+	}
+
+	if _, err := activitypub.FetchActor(h.FediClient, remote.actorID("alice"), nil); err == nil {
+		t.Error("the instance answered an unsigned fetch")
+	}
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+	if len(remote.errors) != 1 {
+		t.Errorf("verification errors = %v", remote.errors)
+	}
+}
+
+// a reply can only be edited or deleted by the actor who wrote it, not by
+// anyone else with an account on the same server
+func TestReplyEditsAndDeletes(t *testing.T) {
+	h, remote, router := newFederatedHandler(t)
+	if err := h.DB.AutoMigrate(&models.Post{}, &models.Comment{}); err != nil {
+		t.Fatal(err)
+	}
+	post := models.Post{Title: "Hello", Slug: "hello", Content: "<p>Hi</p>", Published: true}
+	if err := h.DB.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(name string, activity gin.H) {
+		t.Helper()
+		activity["actor"] = remote.actorID(name)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, inboxRequest(t, activity, remote.actorID(name)+"#main-key", remote.keys[name]))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("inbox answered %d to %s: %s", w.Code, name, w.Body)
+		}
+	}
+	reply := func() models.Comment {
+		t.Helper()
+		var comment models.Comment
+		h.DB.Where("post_id = ?", post.ID).First(&comment)
+		return comment
+	}
+	noteID := remote.actorID("alice") + "/statuses/1"
+	note := func(content string) gin.H {
+		return gin.H{
+			"id":           noteID,
+			"type":         "Note",
+			"attributedTo": remote.actorID("alice"),
+			"inReplyTo":    "https://blog.example/posts/hello",
+			"content":      content,
+		}
+	}
+
+	send("alice", gin.H{"id": noteID + "/activity", "type": "Create", "object": note("<p>Nice post</p>")})
+	comment := reply()
+	if comment.Content != "Nice post" || comment.Status != models.CommentPending || comment.RemoteAuthor != remote.actorID("alice") {
+		t.Fatalf("stored reply = %+v", comment)
+	}
+	h.DB.Model(&comment).Update("status", models.CommentApproved)
+
+	// bob is on the same server, but the reply is not his
+	send("bob", gin.H{"id": noteID + "#edit-bob", "type": "Update", "object": note("<p>Buy pills</p>")})
+	if comment := reply(); comment.Content != "Nice post" || comment.Status != models.CommentApproved {
+		t.Errorf("bob edited alice's reply: %q, %s", comment.Content, comment.Status)
+	}
+	send("bob", gin.H{"id": noteID + "#delete-bob", "type": "Delete", "object": noteID})
+	if reply().ID == 0 {
+		t.Fatal("bob deleted alice's reply")
+	}
+
+	send("alice", gin.H{"id": noteID + "#edit", "type": "Update", "object": note("<p>Nice post, edited</p>")})
+	if comment := reply(); comment.Content != "Nice post, edited" || comment.Status != models.CommentPending {
+		t.Errorf("after alice's edit the reply is %q, %s, want it back in moderation", comment.Content, comment.Status)
+	}
+
+	send("alice", gin.H{"id": noteID + "#delete", "type": "Delete", "object": noteID})
+	if reply().ID != 0 {
+		t.Error("alice could not delete her reply")
+	}
+}
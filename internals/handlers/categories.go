@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"RustyBits/internals/feed"
+	"RustyBits/internals/models"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Public category pages
+
+func (h *Handler) GetCategories(c *gin.Context) {
+	var categories []models.Category
+
+	result := h.DB.Order("name ASC").Find(&categories)
+
+	if result.Error != nil {
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "failed to load categories",
+		})
+		return
+	}
+
+	h.render(c, http.StatusOK, "categories.html", gin.H{
+		"categories": buildCategoryTree(categories),
+		"title":      "Categories",
+	})
+}
+
+func (h *Handler) GetPostsByCategory(c *gin.Context) {
+	var category models.Category
+	if err := h.DB.Where("slug = ?", c.Param("slug")).First(&category).Error; err != nil {
+		h.render(c, http.StatusNotFound, "404.html", gin.H{
+			"message": "Category Not Found",
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit := h.Settings.Get().PostsPerPage
+	offset := (page - 1) * limit
+
+	ids, err := h.categoryDescendantIDs(category.ID)
+	if err != nil {
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "failed to load posts",
+		})
+		return
+	}
+
+	var posts []models.Post
+	var total int64
+
+	h.DB.Model(&models.Post{}).
+		Where("category_id IN ? AND published = ?", ids, true).
+		Count(&total)
+
+	result := h.DB.Where("category_id IN ? AND published = ?", ids, true).
+		Preload("Tags").
+		Preload("Category").
+		Preload("Author").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&posts)
+
+	if result.Error != nil {
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "failed to load posts",
+		})
+		return
+	}
+
+	var children []models.Category
+	h.DB.Where("parent_id = ?", category.ID).Order("name ASC").Find(&children)
+
+	totalPages := int((total + int64(limit) - 1) / int64(limit))
+
+	h.render(c, http.StatusOK, "posts.html", gin.H{
+		"posts":       posts,
+		"currentPage": page,
+		"totalPages":  totalPages,
+		"hasNext":     page < totalPages,
+		"hasPrev":     page > 1,
+		"title":       fmt.Sprintf("Posts in: %s", category.Name),
+		"category":    category,
+		"children":    children,
+		"hFeed":       h.hFeed(fmt.Sprintf("Posts in: %s", category.Name), "/categories/"+category.Slug, posts),
+		"breadcrumbs": h.categoryBreadcrumbs(&category),
+		"feeds": append(feedLinks(category.Name, "/categories/"+category.Slug+"/rss"),
+			siteFeedLinks(h.Settings.Get().Title)...),
+	})
+}
+
+func (h *Handler) CategoryRSS(c *gin.Context) {
+	var category models.Category
+	if err := h.DB.Where("slug = ?", c.Param("slug")).First(&category).Error; err != nil {
+		c.String(http.StatusNotFound, "Category not found")
+		return
+	}
+
+	ids, err := h.categoryDescendantIDs(category.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error generating RSS feed")
+		return
+	}
+
+	site := h.Settings.Get()
+	path := "/categories/" + category.Slug
+
+	h.postFeed(c, feed.Feed{
+		Title:       fmt.Sprintf("%s: %s", site.Title, category.Name),
+		Description: firstNonEmpty(category.Description, site.Tagline),
+		Link:        site.URL(path),
+	}, path+"/rss", c.DefaultQuery("format", "rss"), h.DB.Where("category_id IN ? AND published = ?", ids, true))
+}
+
+// Admin category management
+
+func (h *Handler) AdminCategories(c *gin.Context) {
+	var categories []models.Category
+	h.DB.Preload("Parent").Order("name ASC").Find(&categories)
+
+	h.render(c, http.StatusOK, "admin/categories.html", gin.H{
+		"categories": categories,
+		"title":      "Manage Categories",
+	})
+}
+
+func (h *Handler) CreateCategory(c *gin.Context) {
+	category := models.Category{
+		Name:        c.PostForm("name"),
+		Description: c.PostForm("description"),
+		ParentID:    parseOptionalID(c.PostForm("parent_id")),
+	}
+
+	if category.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if !h.categoryExists(category.ParentID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "parent category does not exist"})
+		return
+	}
+
+	category.Slug = h.categorySlug(category.Name, category.ParentID, 0)
+
+	if err := h.DB.Create(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "categoryCreated")
+		h.render(c, http.StatusOK, "admin/category-row.html", gin.H{"category": category})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/categories")
+}
+
+func (h *Handler) UpdateCategory(c *gin.Context) {
+	var category models.Category
+	if err := h.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category Not Found"})
+		return
+	}
+
+	if name := c.PostForm("name"); name != "" && name != category.Name {
+		category.Name = name
+		category.Slug = h.categorySlug(name, category.ParentID, category.ID)
+	}
+	if description, ok := c.GetPostForm("description"); ok {
+		category.Description = description
+	}
+
+	// a form without parent_id leaves the category where it is, an empty
+	// parent_id moves it to the top level
+	if value, ok := c.GetPostForm("parent_id"); ok {
+		parentID := parseOptionalID(value)
+		if !h.categoryExists(parentID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parent category does not exist"})
+			return
+		}
+		if parentID != nil {
+			ids, err := h.categoryDescendantIDs(category.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			for _, id := range ids {
+				if id == *parentID {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "a category cannot be moved under itself or its descendants"})
+					return
+				}
+			}
+		}
+		category.ParentID = parentID
+		category.Parent = nil
+	}
+
+	if err := h.DB.Save(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "categoryUpdated")
+		h.render(c, http.StatusOK, "admin/category-row.html", gin.H{"category": category})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/categories")
+}
+
+func (h *Handler) DeleteCategory(c *gin.Context) {
+	var category models.Category
+	if err := h.DB.First(&category, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	// children move up to the deleted category's parent and its posts lose
+	// their primary category rather than disappearing with it
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Category{}).
+			Where("parent_id = ?", category.ID).
+			Update("parent_id", category.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Post{}).
+			Where("category_id = ?", category.ID).
+			Update("category_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "categoryDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/categories")
+}
+
+// Category helpers
+
+// buildCategoryTree nests a flat category list under its roots, keeping the input order
+func buildCategoryTree(categories []models.Category) []models.Category {
+	children := make(map[uint][]models.Category)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var attach func(category models.Category, depth int) models.Category
+	attach = func(category models.Category, depth int) models.Category {
+		if depth > len(categories) {
+			return category
+		}
+		for _, child := range children[category.ID] {
+			category.Children = append(category.Children, attach(child, depth+1))
+		}
+		return category
+	}
+
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, attach(category, 0))
+		}
+	}
+	return roots
+}
+
+// categoryDescendantIDs returns the id of the category and of every category below it
+func (h *Handler) categoryDescendantIDs(rootID uint) ([]uint, error) {
+	ids := []uint{rootID}
+	frontier := []uint{rootID}
+
+	for len(frontier) > 0 {
+		var next []uint
+		if err := h.DB.Model(&models.Category{}).
+			Where("parent_id IN ?", frontier).
+			Pluck("id", &next).Error; err != nil {
+			return nil, err
+		}
+		ids = append(ids, next...)
+		frontier = next
+	}
+
+	return ids, nil
+}
+
+// categoryBreadcrumbs walks up from the category to the root, returning the trail root first
+func (h *Handler) categoryBreadcrumbs(category *models.Category) []models.Category {
+	if category == nil {
+		return nil
+	}
+
+	trail := []models.Category{*category}
+	seen := map[uint]bool{category.ID: true}
+	parentID := category.ParentID
+
+	for parentID != nil && !seen[*parentID] {
+		var parent models.Category
+		if err := h.DB.First(&parent, *parentID).Error; err != nil {
+			break
+		}
+		seen[parent.ID] = true
+		trail = append([]models.Category{parent}, trail...)
+		parentID = parent.ParentID
+	}
+
+	return trail
+}
+
+// categorySlug derives a unique slug, prefixing the parent's slug when the plain one is taken
+func (h *Handler) categorySlug(name string, parentID *uint, selfID uint) string {
+	slug := generateSlug(name)
+	if !h.categorySlugTaken(slug, selfID) {
+		return slug
+	}
+
+	if parentID != nil {
+		var parent models.Category
+		if err := h.DB.First(&parent, *parentID).Error; err == nil {
+			slug = parent.Slug + "-" + slug
+			if !h.categorySlugTaken(slug, selfID) {
+				return slug
+			}
+		}
+	}
+
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", slug, i)
+		if !h.categorySlugTaken(candidate, selfID) {
+			return candidate
+		}
+	}
+}
+
+// categoryExists reports whether id names a category, a nil id being the top level
+func (h *Handler) categoryExists(id *uint) bool {
+	if id == nil {
+		return true
+	}
+	var count int64
+	h.DB.Model(&models.Category{}).Where("id = ?", *id).Count(&count)
+	return count > 0
+}
+
+func (h *Handler) categorySlugTaken(slug string, selfID uint) bool {
+	var existing models.Category
+	return h.DB.Where("slug = ? AND id <> ?", slug, selfID).First(&existing).Error == nil
+}
+
+func parseOptionalID(value string) *uint {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		return nil
+	}
+	v := uint(id)
+	return &v
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/spam"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Limits on what readers can submit
+const (
+	commentMaxLength = 5000
+	commentNameMax   = 100
+)
+
+// commentStatuses are the statuses a moderator can move comments between
+var commentStatuses = []string{models.CommentPending, models.CommentApproved, models.CommentSpam}
+
+// Public comments
+
+// GetComments renders the approved comments of a post, for HTMX to refresh the thread
+func (h *Handler) GetComments(c *gin.Context) {
+	var post models.Post
+	if err := h.DB.Where("slug = ? AND published = ?", c.Param("slug"), true).First(&post).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	h.render(c, http.StatusOK, "comments.html", h.commentsData(post))
+}
+
+func (h *Handler) CreateComment(c *gin.Context) {
+	var post models.Post
+	if err := h.DB.Where("slug = ? AND published = ?", c.Param("slug"), true).First(&post).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post Not Found"})
+		return
+	}
+
+	if !h.commentsOpen(post) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Comments are closed"})
+		return
+	}
+
+	comment := models.Comment{
+		PostID:    post.ID,
+		ParentID:  parseOptionalID(c.PostForm("parent_id")),
+		Name:      strings.TrimSpace(c.PostForm("name")),
+		Email:     strings.TrimSpace(c.PostForm("email")),
+		Website:   strings.TrimSpace(c.PostForm("website")),
+		Content:   strings.TrimSpace(c.PostForm("content")),
+		Status:    models.CommentPending,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	if err := h.validateComment(&comment); err != nil {
+		h.render(c, http.StatusBadRequest, "comment-form.html", gin.H{
+			"post":      post,
+			"comment":   comment,
+			"formStamp": c.PostForm(spam.StampField),
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	submission := commentSubmission(comment)
+	submission.Honeypot = c.PostForm(spam.HoneypotField)
+	submission.Stamp = c.PostForm(spam.StampField)
+
+	verdict, err := h.Spam.Check(submission)
+	if err != nil {
+		log.Printf("Spam check failed, holding comment for moderation: %v", err)
+		verdict.Score = 0.5
+	}
+	comment.SpamScore = verdict.Score
+	comment.Status = h.spamStatus(verdict)
+
+	// the site's own authors skip the queue
+	if c.GetUint("user_id") != 0 {
+		comment.Status = models.CommentApproved
+	}
+
+	if err := h.DB.Create(&comment).Error; err != nil {
+		h.render(c, http.StatusInternalServerError, "comment-form.html", gin.H{
+			"post":    post,
+			"comment": comment,
+			"error":   "Failed to save comment",
+		})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		if comment.Status == models.CommentApproved {
+			c.Header("HX-Trigger", "commentCreated")
+		}
+		h.render(c, http.StatusOK, "comment-form.html", gin.H{
+			"post":      post,
+			"submitted": comment,
+		})
+		return
+	}
+
+	anchor := "#comments"
+	if comment.Status == models.CommentApproved {
+		anchor = fmt.Sprintf("#comment-%d", comment.ID)
+	}
+	c.Redirect(http.StatusFound, "/posts/"+post.Slug+anchor)
+}
+
+// Admin moderation queue
+
+func (h *Handler) AdminComments(c *gin.Context) {
+	status := c.DefaultQuery("status", models.CommentPending)
+	if !isCommentStatus(status) {
+		status = models.CommentPending
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 50
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.Comment{}).Where("status = ?", status)
+	if postID := parseOptionalID(c.Query("post")); postID != nil {
+		query = query.Where("post_id = ?", *postID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var comments []models.Comment
+	result := query.Preload("Post").
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&comments)
+	if result.Error != nil {
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load comments",
+		})
+		return
+	}
+
+	counts := make(map[string]int64, len(commentStatuses))
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	h.DB.Model(&models.Comment{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows)
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	totalPages := int((total + int64(limit) - 1) / int64(limit))
+
+	h.render(c, http.StatusOK, "admin/comments.html", gin.H{
+		"comments":    comments,
+		"status":      status,
+		"statuses":    commentStatuses,
+		"counts":      counts,
+		"currentPage": page,
+		"totalPages":  totalPages,
+		"hasNext":     page < totalPages,
+		"hasPrev":     page > 1,
+		"title":       "Moderate Comments",
+	})
+}
+
+// BulkComments applies one moderation action to every selected comment
+func (h *Handler) BulkComments(c *gin.Context) {
+	var ids []uint
+	for _, value := range c.PostFormArray("ids") {
+		if id := parseOptionalID(value); id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no comments selected"})
+		return
+	}
+
+	var err error
+	switch action := c.PostForm("action"); action {
+	case "approve":
+		err = h.setCommentStatus(ids, models.CommentApproved)
+	case "spam":
+		err = h.setCommentStatus(ids, models.CommentSpam)
+	case "pending":
+		err = h.setCommentStatus(ids, models.CommentPending)
+	case "delete":
+		err = h.deleteComments(ids)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown action %q", action)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "commentsModerated")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/comments?status="+url.QueryEscape(c.DefaultPostForm("status", models.CommentPending)))
+}
+
+func (h *Handler) DeleteComment(c *gin.Context) {
+	var comment models.Comment
+	if err := h.DB.First(&comment, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := h.deleteComments([]uint{comment.ID}); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "commentDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/comments")
+}
+
+// ToggleComments turns comments on or off for a single post
+func (h *Handler) ToggleComments(c *gin.Context) {
+	var post models.Post
+	if err := h.DB.First(&post, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	post.CommentsDisabled = !post.CommentsDisabled
+	if err := h.DB.Model(&post).UpdateColumn("comments_disabled", post.CommentsDisabled).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	h.render(c, http.StatusOK, "admin/post-comments-status.html", gin.H{
+		"post":         post,
+		"commentsOpen": h.commentsOpen(post),
+	})
+}
+
+// Comment helpers
+
+func isCommentStatus(status string) bool {
+	for _, s := range commentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// commentsOpen reports whether a post still accepts comments: they must not be
+// disabled for the post and the post must be younger than CommentsCloseDays
+func (h *Handler) commentsOpen(post models.Post) bool {
+	if post.CommentsDisabled {
+		return false
+	}
+	days := h.Settings.Get().CommentsCloseDays
+	return days == 0 || time.Since(post.CreatedAt) < time.Duration(days)*24*time.Hour
+}
+
+// commentsData is what the comment thread and form of a post render from
+func (h *Handler) commentsData(post models.Post) gin.H {
+	var comments []models.Comment
+	h.DB.Where("post_id = ? AND status = ?", post.ID, models.CommentApproved).
+		Order("created_at ASC").
+		Find(&comments)
+
+	return gin.H{
+		"post":         post,
+		"comments":     buildCommentTree(comments),
+		"commentCount": len(comments),
+		"commentsOpen": h.commentsOpen(post),
+		"formStamp":    h.Spam.Stamp(time.Now()),
+	}
+}
+
+// buildCommentTree nests replies under the comments they answer. Replies to
+// a comment that is not shown are lifted to the top level rather than lost.
+func buildCommentTree(comments []models.Comment) []models.Comment {
+	shown := make(map[uint]bool, len(comments))
+	for _, comment := range comments {
+		shown[comment.ID] = true
+	}
+
+	replies := make(map[uint][]models.Comment)
+	var roots []models.Comment
+	for _, comment := range comments {
+		if comment.ParentID != nil && shown[*comment.ParentID] {
+			replies[*comment.ParentID] = append(replies[*comment.ParentID], comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+
+	var attach func(comment models.Comment, depth int) models.Comment
+	attach = func(comment models.Comment, depth int) models.Comment {
+		if depth > len(comments) {
+			return comment
+		}
+		for _, reply := range replies[comment.ID] {
+			comment.Replies = append(comment.Replies, attach(reply, depth+1))
+		}
+		return comment
+	}
+
+	for i := range roots {
+		roots[i] = attach(roots[i], 0)
+	}
+	return roots
+}
+
+// validateComment checks a reader's submission and drops a parent that is not
+// an approved comment on the same post
+func (h *Handler) validateComment(comment *models.Comment) error {
+	if comment.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(comment.Name) > commentNameMax {
+		return fmt.Errorf("name must be at most %d characters", commentNameMax)
+	}
+	if comment.Content == "" {
+		return errors.New("comment is required")
+	}
+	if len(comment.Content) > commentMaxLength {
+		return fmt.Errorf("comment must be at most %d characters", commentMaxLength)
+	}
+	if comment.Email != "" {
+		if _, err := mail.ParseAddress(comment.Email); err != nil {
+			return errors.New("email address is not valid")
+		}
+	}
+	if comment.Website != "" {
+		u, err := url.Parse(comment.Website)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("website must be an http(s) url")
+		}
+	}
+
+	if comment.ParentID != nil {
+		var parent models.Comment
+		err := h.DB.Where("id = ? AND post_id = ? AND status = ?", *comment.ParentID, comment.PostID, models.CommentApproved).
+			First(&parent).Error
+		if err != nil {
+			comment.ParentID = nil
+		}
+	}
+	return nil
+}
+
+// spamStatus is the status a new submission gets from the filter's verdict
+func (h *Handler) spamStatus(verdict spam.Verdict) string {
+	site := h.Settings.Get()
+	switch verdict.Route(site.SpamThreshold, site.ApproveThreshold) {
+	case spam.Spam:
+		return models.CommentSpam
+	case spam.Ham:
+		return models.CommentApproved
+	default:
+		return models.CommentPending
+	}
+}
+
+func commentSubmission(comment models.Comment) spam.Submission {
+	return spam.Submission{
+		Name:    comment.Name,
+		Email:   comment.Email,
+		Website: comment.Website,
+		Body:    comment.Content,
+	}
+}
+
+// setCommentStatus moves comments to status. Approving or marking as spam
+// also teaches the spam filter, undoing what it was taught about the comment
+// before if the moderator changed their mind.
+func (h *Handler) setCommentStatus(ids []uint, status string) error {
+	var comments []models.Comment
+	if err := h.DB.Where("id IN ?", ids).Find(&comments).Error; err != nil {
+		return err
+	}
+
+	trainAs := map[string]string{models.CommentApproved: spam.Ham, models.CommentSpam: spam.Spam}[status]
+
+	for _, comment := range comments {
+		if comment.TrainedAs != trainAs {
+			submission := commentSubmission(comment)
+			if comment.TrainedAs != "" {
+				if err := h.Spam.Untrain(submission, comment.TrainedAs == spam.Spam); err != nil {
+					return err
+				}
+			}
+			if trainAs != "" {
+				if err := h.Spam.Train(submission, trainAs == spam.Spam); err != nil {
+					return err
+				}
+			}
+		}
+
+		err := h.DB.Model(&comment).Updates(map[string]any{"status": status, "trained_as": trainAs}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteComments removes comments, moving their replies up to the deleted
+// comment's parent so a thread survives losing one of its messages
+func (h *Handler) deleteComments(ids []uint) error {
+	return h.DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			// read each comment inside the loop, an earlier deletion may have moved it
+			var comment models.Comment
+			if err := tx.First(&comment, id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return err
+			}
+			if err := tx.Model(&models.Comment{}).
+				Where("parent_id = ?", comment.ID).
+				Update("parent_id", comment.ParentID).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&comment).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
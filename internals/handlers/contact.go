@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"RustyBits/internals/mailer"
+	"RustyBits/internals/models"
+	"RustyBits/internals/spam"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on what the contact form accepts
+const (
+	messageMaxLength  = 10000
+	messageSubjectMax = 200
+)
+
+// messageStatuses are the folders of the admin inbox
+var messageStatuses = []string{models.MessageUnread, models.MessageRead, models.MessageArchived, models.MessageSpam}
+
+func (h *Handler) ContactForm(c *gin.Context) {
+	h.render(c, http.StatusOK, "contact.html", gin.H{
+		"formStamp": h.Spam.Stamp(time.Now()),
+		"title":     "Contact",
+	})
+}
+
+// SendContact stores a message for the admin inbox. Messages the spam filter
+// is sure about go straight to the spam folder, and everything else is
+// forwarded to the contact email when one is set.
+func (h *Handler) SendContact(c *gin.Context) {
+	msg := models.ContactMessage{
+		Name:      strings.TrimSpace(c.PostForm("name")),
+		Email:     strings.TrimSpace(c.PostForm("email")),
+		Subject:   strings.TrimSpace(c.PostForm("subject")),
+		Body:      strings.TrimSpace(c.PostForm("body")),
+		Status:    models.MessageUnread,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	if err := validateMessage(msg); err != nil {
+		h.renderContactForm(c, http.StatusBadRequest, gin.H{
+			"message":   msg,
+			"formStamp": c.PostForm(spam.StampField),
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	submission := messageSubmission(msg)
+	submission.Honeypot = c.PostForm(spam.HoneypotField)
+	submission.Stamp = c.PostForm(spam.StampField)
+
+	verdict, err := h.Spam.Check(submission)
+	if err != nil {
+		log.Printf("Spam check failed, delivering message anyway: %v", err)
+		verdict.Score = 0.5
+	}
+	msg.SpamScore = verdict.Score
+	if h.spamStatus(verdict) == models.CommentSpam {
+		msg.Status = models.MessageSpam
+	}
+
+	if err := h.DB.Create(&msg).Error; err != nil {
+		h.renderContactForm(c, http.StatusInternalServerError, gin.H{
+			"message":   msg,
+			"formStamp": c.PostForm(spam.StampField),
+			"error":     "Failed to send message",
+		})
+		return
+	}
+
+	if msg.Status != models.MessageSpam && h.Settings.Get().ContactEmail != "" {
+		go h.forwardMessage(msg)
+	}
+
+	h.renderContactForm(c, http.StatusOK, gin.H{"submitted": true})
+}
+
+// Admin inbox
+
+// AdminMessages lists one folder of the inbox. Without a status it shows
+// everything not archived or spam, unread and read together.
+func (h *Handler) AdminMessages(c *gin.Context) {
+	status := c.Query("status")
+	query := h.DB.Model(&models.ContactMessage{})
+	if isMessageStatus(status) {
+		query = query.Where("status = ?", status)
+	} else {
+		status = ""
+		query = query.Where("status IN ?", []string{models.MessageUnread, models.MessageRead})
+	}
+
+	var messages []models.ContactMessage
+	if err := query.Order("created_at DESC").Limit(200).Find(&messages).Error; err != nil {
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load messages",
+		})
+		return
+	}
+
+	counts := make(map[string]int64, len(messageStatuses))
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	h.DB.Model(&models.ContactMessage{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows)
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	replyLinks := make(map[uint]string, len(messages))
+	for _, msg := range messages {
+		replyLinks[msg.ID] = replyMailto(msg)
+	}
+
+	h.render(c, http.StatusOK, "admin/messages.html", gin.H{
+		"messages":   messages,
+		"replyLinks": replyLinks,
+		"status":     status,
+		"statuses":   messageStatuses,
+		"counts":     counts,
+		"title":      "Messages",
+	})
+}
+
+// GetMessage shows a whole message, marking it read
+func (h *Handler) GetMessage(c *gin.Context) {
+	var msg models.ContactMessage
+	if err := h.DB.First(&msg, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message Not Found"})
+		return
+	}
+
+	if msg.Status == models.MessageUnread {
+		msg.Status = models.MessageRead
+		h.DB.Model(&msg).UpdateColumn("status", msg.Status)
+	}
+
+	h.render(c, http.StatusOK, "admin/message.html", gin.H{
+		"message":   msg,
+		"replyLink": replyMailto(msg),
+		"title":     firstNonEmpty(msg.Subject, "Message from "+msg.Name),
+	})
+}
+
+// UpdateMessage moves a message to another folder. Marking it spam, or
+// rescuing it from spam, teaches the spam filter.
+func (h *Handler) UpdateMessage(c *gin.Context) {
+	var msg models.ContactMessage
+	if err := h.DB.First(&msg, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message Not Found"})
+		return
+	}
+
+	status := c.PostForm("status")
+	if !isMessageStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown status %q", status)})
+		return
+	}
+
+	if err := h.setMessageStatus(&msg, status); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "messageUpdated")
+		h.render(c, http.StatusOK, "admin/message-row.html", gin.H{
+			"message":   msg,
+			"replyLink": replyMailto(msg),
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/messages")
+}
+
+func (h *Handler) DeleteMessage(c *gin.Context) {
+	var msg models.ContactMessage
+	if err := h.DB.First(&msg, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message Not Found"})
+		return
+	}
+
+	if err := h.DB.Delete(&msg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "messageDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/messages")
+}
+
+// Contact helpers
+
+func isMessageStatus(status string) bool {
+	for _, s := range messageStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func validateMessage(msg models.ContactMessage) error {
+	if msg.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(msg.Name) > commentNameMax {
+		return fmt.Errorf("name must be at most %d characters", commentNameMax)
+	}
+	if _, err := mail.ParseAddress(msg.Email); err != nil {
+		return errors.New("a valid email address is required so we can reply")
+	}
+	if len(msg.Subject) > messageSubjectMax {
+		return fmt.Errorf("subject must be at most %d characters", messageSubjectMax)
+	}
+	if msg.Body == "" {
+		return errors.New("message is required")
+	}
+	if len(msg.Body) > messageMaxLength {
+		return fmt.Errorf("message must be at most %d characters", messageMaxLength)
+	}
+	return nil
+}
+
+func messageSubmission(msg models.ContactMessage) spam.Submission {
+	return spam.Submission{
+		Name:  msg.Name,
+		Email: msg.Email,
+		Body:  msg.Subject + "\n" + msg.Body,
+	}
+}
+
+// setMessageStatus moves a message, training the filter the same way
+// setCommentStatus does
+func (h *Handler) setMessageStatus(msg *models.ContactMessage, status string) error {
+	trainAs := msg.TrainedAs
+	switch {
+	case status == models.MessageSpam:
+		trainAs = spam.Spam
+	case msg.Status == models.MessageSpam:
+		trainAs = spam.Ham
+	}
+
+	if trainAs != msg.TrainedAs {
+		submission := messageSubmission(*msg)
+		if msg.TrainedAs != "" {
+			if err := h.Spam.Untrain(submission, msg.TrainedAs == spam.Spam); err != nil {
+				return err
+			}
+		}
+		if err := h.Spam.Train(submission, trainAs == spam.Spam); err != nil {
+			return err
+		}
+	}
+
+	msg.Status = status
+	msg.TrainedAs = trainAs
+	return h.DB.Model(msg).Updates(map[string]any{"status": status, "trained_as": trainAs}).Error
+}
+
+// forwardMessage emails a message to the contact address, with Reply-To set
+// so answering it goes straight to the sender
+func (h *Handler) forwardMessage(msg models.ContactMessage) {
+	site := h.Settings.Get()
+	subject := firstNonEmpty(msg.Subject, "Message from "+msg.Name)
+
+	err := h.Mailer.Send(mailer.Message{
+		To:      site.ContactEmail,
+		Subject: "[" + site.Title + "] " + subject,
+		Text: fmt.Sprintf("%s <%s> wrote:\n\n%s\n\n%s\n",
+			msg.Name, msg.Email, msg.Body, site.URL(fmt.Sprintf("/admin/messages/%d", msg.ID))),
+		Headers: map[string]string{
+			"Reply-To": (&mail.Address{Name: msg.Name, Address: msg.Email}).String(),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to forward message %d: %v", msg.ID, err)
+		return
+	}
+	h.DB.Model(&msg).UpdateColumn("forwarded_at", time.Now())
+}
+
+// replyMailto is a mailto link answering msg, quoting it below
+func replyMailto(msg models.ContactMessage) string {
+	subject := firstNonEmpty(msg.Subject, "Your message")
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	quoted := "\n\n" + msg.Name + " wrote:\n> " + strings.ReplaceAll(msg.Body, "\n", "\n> ")
+	query := url.Values{"subject": {subject}, "body": {quoted}}
+	// mail clients read + literally, spaces have to be %20
+	return "mailto:" + url.PathEscape(msg.Email) + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// renderContactForm renders just the form for HTMX and the whole page
+// otherwise
+func (h *Handler) renderContactForm(c *gin.Context, status int, data gin.H) {
+	if c.GetHeader("HX-Request") == "true" {
+		h.render(c, status, "contact-form.html", data)
+		return
+	}
+	data["title"] = "Contact"
+	h.render(c, status, "contact.html", data)
+}
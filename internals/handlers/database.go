@@ -1,9 +1,23 @@
 package handlers
 
 import (
+	"RustyBits/internals/activitypub"
+	"RustyBits/internals/mailer"
 	"RustyBits/internals/models"
+	"RustyBits/internals/newsletter"
+	"RustyBits/internals/notify"
+	"RustyBits/internals/pow"
+	"RustyBits/internals/settings"
+	"RustyBits/internals/spam"
+	"RustyBits/internals/storage"
+	"RustyBits/internals/webhook"
+	"RustyBits/internals/webmention"
+	"context"
+	"crypto/rsa"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -14,29 +28,99 @@ import (
 )
 
 type Handler struct {
-	DB *gorm.DB
+	DB       *gorm.DB
+	Settings *settings.Store
+	Storage  storage.Storage
+	Notifier *notify.Notifier
+	Spam     *spam.Filter
+	PoW      *pow.Verifier
+	Mailer   mailer.Mailer
+
+	Webmentions *webmention.Receiver
+	Newsletter  *newsletter.Service
+	Webhooks    *webhook.Dispatcher
+
+	// ActorKey signs what the blog sends to the fediverse, and FediClient
+	// fetches the actors of incoming activities
+	ActorKey   *rsa.PrivateKey
+	FediClient *http.Client
+
+	nav *navCache
 }
 
 func NewHandler(db *gorm.DB) *Handler {
-	return &Handler{DB: db}
+	store, err := settings.NewStore(db)
+	if err != nil {
+		log.Printf("Failed to load settings, using defaults: %v", err)
+	}
+
+	secret, err := store.Secret()
+	if err != nil {
+		log.Fatal("Failed to load application secret: ", err)
+	}
+
+	actorKeyPEM, err := store.Generated("activitypub_key", activitypub.GenerateKey)
+	if err != nil {
+		log.Fatal("Failed to load ActivityPub key: ", err)
+	}
+	actorKey, err := activitypub.ParsePrivateKey(actorKeyPEM)
+	if err != nil {
+		log.Fatal("Failed to parse ActivityPub key: ", err)
+	}
+
+	files, err := storage.New(storage.ConfigFromEnv(), secret)
+	if err != nil {
+		log.Fatal("Failed to configure storage: ", err)
+	}
+
+	mail, err := mailer.New(mailer.ConfigFromEnv())
+	if err != nil {
+		log.Fatal("Failed to configure mail: ", err)
+	}
+
+	h := &Handler{
+		DB:       db,
+		Settings: store,
+		Storage:  files,
+		Notifier: notify.New(db, store),
+		Spam:     spam.New(db, secret),
+		PoW:      pow.New(secret, func() int { return store.Get().PowDifficulty }),
+		Mailer:   mail,
+
+		Webmentions: webmention.NewReceiver(db),
+		Newsletter:  newsletter.New(db, store, mail, secret),
+		Webhooks:    webhook.New(db),
+		ActorKey:    actorKey,
+		FediClient:  webmention.SafeClient(15 * time.Second),
+		nav:         &navCache{},
+	}
+	h.Notifier.SignActivity = h.signActivity
+	h.rebuildMediaUsage()
+	h.Notifier.Start(2)
+	h.Webmentions.Start(2)
+	h.Newsletter.Start(2)
+	h.Webhooks.Start(2)
+
+	return h
 }
 
 // API routes
 func (h *Handler) GetPostsJson(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit := 10
+	limit := h.Settings.Get().PostsPerPage
 	offset := (page - 1) * limit
 
 	var posts []models.Post
 	result := h.DB.Where("published = ?", true).
 		Preload("Tags").
+		Preload("Series").
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
 		Find(&posts)
 
 	if result.Error != nil {
-		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
 			"error": "failed to load posts",
 		})
 		return
@@ -51,7 +135,7 @@ func (h *Handler) GetPostsJson(c *gin.Context) {
 func (h *Handler) GetPostJson(c *gin.Context) {
 	id := c.Param("id")
 	var post models.Post
-	result := h.DB.Preload("Tags").First(&post, id)
+	result := h.DB.Preload("Tags").Preload("Series").First(&post, id)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Post Not Found"})
@@ -83,7 +167,7 @@ func (h *Handler) AdminDashboard(c *gin.Context) {
 
 	h.DB.Preload("Tags").Order("created_at DESC").Limit(5).Find(&recentPosts)
 
-	c.HTML(http.StatusOK, "admin/dashboard.html", gin.H{
+	h.render(c, http.StatusOK, "admin/dashboard.html", gin.H{
 		"stats":       stats,
 		"recentPosts": recentPosts,
 		"title":       "Dashboard",
@@ -92,7 +176,7 @@ func (h *Handler) AdminDashboard(c *gin.Context) {
 
 func (h *Handler) AdminPosts(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit := 20
+	limit := h.Settings.Get().PostsPerPage
 	offset := (page - 1) * limit
 
 	var posts []models.Post
@@ -106,7 +190,7 @@ func (h *Handler) AdminPosts(c *gin.Context) {
 		Find(&posts)
 
 	if result.Error != nil {
-		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
 			"error": "Failed to load posts",
 		})
 		return
@@ -114,7 +198,7 @@ func (h *Handler) AdminPosts(c *gin.Context) {
 
 	totalPages := int((total + int64(limit) - 1) / int64(limit))
 
-	c.HTML(http.StatusOK, "admin/posts.html", gin.H{
+	h.render(c, http.StatusOK, "admin/posts.html", gin.H{
 		"posts":       posts,
 		"currentPage": page,
 		"totalPages":  totalPages,
@@ -128,12 +212,20 @@ func (h *Handler) NewPostForm(c *gin.Context) {
 	var tags []models.Tag
 	h.DB.Find(&tags)
 
-	c.HTML(http.StatusOK, "admin/post-form.html", gin.H{
-		"post":   models.Post{},
-		"tags":   tags,
-		"title":  "New Post",
-		"action": "/admin/posts",
-		"method": "Post",
+	var categories []models.Category
+	h.DB.Order("name ASC").Find(&categories)
+
+	var series []models.Series
+	h.DB.Order("title ASC").Find(&series)
+
+	h.render(c, http.StatusOK, "admin/post-form.html", gin.H{
+		"post":       models.Post{},
+		"tags":       tags,
+		"categories": categories,
+		"series":     series,
+		"title":      "New Post",
+		"action":     "/admin/posts",
+		"method":     "Post",
 	})
 }
 
@@ -145,7 +237,7 @@ func (h *Handler) CreatePost(c *gin.Context) {
 		var tags []models.Tag
 		h.DB.Find(&tags)
 
-		c.HTML(http.StatusBadRequest, "admin/post-form.html", gin.H{
+		h.render(c, http.StatusBadRequest, "admin/post-form.html", gin.H{
 			"post":  post,
 			"tags":  tags,
 			"error": err.Error(),
@@ -154,26 +246,38 @@ func (h *Handler) CreatePost(c *gin.Context) {
 	}
 
 	post.Slug = generateSlug(post.Title)
+	post.CategoryID = parseOptionalID(c.PostForm("category_id"))
+	if !h.categoryExists(post.CategoryID) {
+		var tags []models.Tag
+		h.DB.Find(&tags)
 
-	tagNames := c.PostFormArray("tags")
-	var tags []models.Tag
-	for _, tagName := range tagNames {
-		if tagName != "" {
-			var tag models.Tag
-			result := h.DB.Where("name = ?", tagName).First(&tag)
-			if result.Error == gorm.ErrRecordNotFound {
-				tag = models.Tag{Name: tagName}
-				h.DB.Create(&tag)
-			}
-			tags = append(tags, tag)
-		}
+		h.render(c, http.StatusBadRequest, "admin/post-form.html", gin.H{
+			"post":  post,
+			"tags":  tags,
+			"error": "category does not exist",
+		})
+		return
+	}
+	if authorID := c.GetUint("user_id"); authorID != 0 {
+		post.AuthorID = &authorID
+	}
+	h.applySeriesForm(c, &post)
+	if err := h.applySEOForm(c, &post); err != nil {
+		var tags []models.Tag
+		h.DB.Find(&tags)
+
+		h.render(c, http.StatusBadRequest, "admin/post-form.html", gin.H{
+			"post":  post,
+			"tags":  tags,
+			"error": err.Error(),
+		})
+		return
 	}
-	post.Tags = tags
 
-	if err := h.DB.Create(&post).Error; err != nil {
+	if err := h.createPost(&post, c.PostFormArray("tags")); err != nil {
 		var allTags []models.Tag
 		h.DB.Find(&allTags)
-		c.HTML(http.StatusInternalServerError, "admin/post-form.html", gin.H{
+		h.render(c, http.StatusInternalServerError, "admin/post-form.html", gin.H{
 			"post":  post,
 			"tags":  allTags,
 			"error": "Failed to create post",
@@ -184,7 +288,7 @@ func (h *Handler) CreatePost(c *gin.Context) {
 	// For HTMX requests, return the new post row
 	if c.GetHeader("HX-Request") == "true" {
 		c.Header("HX-Trigger", "postCreated")
-		c.HTML(http.StatusOK, "admin/post-row.html", gin.H{"post": post})
+		h.render(c, http.StatusOK, "admin/post-row.html", gin.H{"post": post})
 		return
 	}
 
@@ -194,9 +298,9 @@ func (h *Handler) CreatePost(c *gin.Context) {
 func (h *Handler) EditPostForm(c *gin.Context) {
 	id := c.Param("id")
 	var post models.Post
-	result := h.DB.Preload("Tags").First(&post, id)
+	result := h.DB.Preload("Tags").Preload("FeaturedImage").First(&post, id)
 	if result.Error != nil {
-		c.HTML(http.StatusNotFound, "404.html", gin.H{
+		h.render(c, http.StatusNotFound, "404.html", gin.H{
 			"message": "Post not found",
 		})
 		return
@@ -204,12 +308,21 @@ func (h *Handler) EditPostForm(c *gin.Context) {
 
 	var tags []models.Tag
 	h.DB.Find(&tags)
-	c.HTML(http.StatusOK, "admin/post-form.html", gin.H{
-		"post":   post,
-		"tags":   tags,
-		"title":  "Edit Post",
-		"action": fmt.Sprintf("/admin/posts/%d", post.ID),
-		"method": "PATCH",
+
+	var categories []models.Category
+	h.DB.Order("name ASC").Find(&categories)
+
+	var series []models.Series
+	h.DB.Order("title ASC").Find(&series)
+
+	h.render(c, http.StatusOK, "admin/post-form.html", gin.H{
+		"post":       post,
+		"tags":       tags,
+		"categories": categories,
+		"series":     series,
+		"title":      "Edit Post",
+		"action":     fmt.Sprintf("/admin/posts/%d", post.ID),
+		"method":     "PATCH",
 	})
 }
 
@@ -223,6 +336,7 @@ func (h *Handler) UpodatePost(c *gin.Context) {
 		})
 		return
 	}
+	wasPublished := post.Published
 
 	if err := c.ShouldBind(&post); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -230,34 +344,38 @@ func (h *Handler) UpodatePost(c *gin.Context) {
 	}
 
 	post.Slug = generateSlug(post.Title)
-
-	tagNames := c.PostFormArray("tags")
-	var tags []models.Tag
-	for _, tagName := range tagNames {
-		if tagName != "" {
-			var tag models.Tag
-			result := h.DB.Where("name = ?", tagName).First(&tag)
-			if result.Error == gorm.ErrRecordNotFound {
-				tag = models.Tag{Name: tagName}
-				h.DB.Create(&tag)
-
-			}
-			tags = append(tags, tag)
+	// a form without category_id keeps the post's category
+	if value, ok := c.GetPostForm("category_id"); ok {
+		post.CategoryID = parseOptionalID(value)
+		post.Category = nil
+		if !h.categoryExists(post.CategoryID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "category does not exist"})
+			return
 		}
-
+	}
+	h.applySeriesForm(c, &post)
+	if err := h.applySEOForm(c, &post); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	h.DB.Model(&post).Association("Tags").Replace(tags)
+	h.DB.Model(&post).Association("Tags").Replace(h.tagsByName(c.PostFormArray("tags")))
 
 	if err := h.DB.Save(&post).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.invalidateNav()
+	if err := h.syncMediaUsage(post); err != nil {
+		log.Printf("Failed to index media usage of post %d: %v", post.ID, err)
+	}
+	h.postEvent(models.EventPostUpdated, post)
+	h.notifyChanged(post, wasPublished)
 
 	// For HTMX requests, return updated post
 	if c.GetHeader("HX-Request") == "true" {
 		c.Header("HX-Trigger", "postUpdated")
-		c.HTML(http.StatusOK, "admin/post-row.html", gin.H{"post": post})
+		h.render(c, http.StatusOK, "admin/post-row.html", gin.H{"post": post})
 		return
 	}
 
@@ -273,10 +391,7 @@ func (h *Handler) DeletePost(c *gin.Context) {
 		return
 	}
 
-	// Delete associations first
-	h.DB.Model(&post).Association("Tags").Clear()
-
-	if err := h.DB.Delete(&post).Error; err != nil {
+	if err := h.deletePost(post); err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
 	}
@@ -302,15 +417,17 @@ func (h *Handler) TogglePublished(c *gin.Context) {
 
 	post.Published = !post.Published
 	h.DB.Save(&post)
+	h.invalidateNav()
+	h.notifyChanged(post, !post.Published)
 
 	// Return updated status for HTMX
-	c.HTML(http.StatusOK, "admin/post-status.html", gin.H{"post": post})
+	h.render(c, http.StatusOK, "admin/post-status.html", gin.H{"post": post})
 }
 
 // Auth Routes
 
 func (h *Handler) LoginForm(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.html", gin.H{
+	h.render(c, http.StatusOK, "login.html", gin.H{
 		"title": "Login",
 	})
 }
@@ -322,7 +439,7 @@ func (h *Handler) Login(c *gin.Context) {
 	var user models.User
 	result := h.DB.Where("email = ?", email).First(&user)
 	if result.Error != nil {
-		c.HTML(http.StatusBadRequest, "login.html", gin.H{
+		h.render(c, http.StatusBadRequest, "login.html", gin.H{
 			"error": "Invalid credentials",
 			"email": email,
 		})
@@ -330,7 +447,7 @@ func (h *Handler) Login(c *gin.Context) {
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		c.HTML(http.StatusBadRequest, "login.html", gin.H{
+		h.render(c, http.StatusBadRequest, "login.html", gin.H{
 			"error": "Invalid credentials",
 			"email": email,
 		})
@@ -354,27 +471,34 @@ func (h *Handler) Home(c *gin.Context) {
 
 	result := h.DB.Where("published = ?", true).
 		Preload("Tags").
+		Preload("Author").
 		Order("created_at DESC").
-		Limit(5).
+		Limit(h.Settings.Get().PostsPerPage).
 		Find(&posts)
 
 	if result.Error != nil {
-		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
 			"error": "failed to load posts",
 		})
 		return
 	}
 
-	c.HTML(http.StatusOK, "home.html", gin.H{
-		"posts": posts,
-		"title": "Welcome To My Blog",
+	site := h.Settings.Get()
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="micropub"`, site.URL("/micropub")))
+	h.render(c, http.StatusOK, "home.html", gin.H{
+		"posts":   posts,
+		"title":   site.Title,
+		"tagline": site.Tagline,
+		"hFeed":   h.hFeed(site.Title, "/", posts),
+
+		"micropubEndpoint": site.URL("/micropub"),
 	})
 }
 
 func (h *Handler) GetPostsByTag(c *gin.Context) {
 	tagName := c.Param("tag")
 	page, _ := strconv.Atoi((c.DefaultQuery("page", "1")))
-	limit := 10
+	limit := h.Settings.Get().PostsPerPage
 	offset := (page - 1) * limit
 
 	var posts []models.Post
@@ -391,13 +515,14 @@ func (h *Handler) GetPostsByTag(c *gin.Context) {
 		Joins("JOIN tags ON post_tags.tag_id = tags.id").
 		Where("tags.name = ? AND posts.published = ?", tagName, true).
 		Preload("Tags").
+		Preload("Author").
 		Order("posts.created_at DESC").
 		Limit(limit).
 		Offset(offset).
 		Find(&posts)
 
 	if result.Error != nil {
-		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
 			"error": "failed to load posts",
 		})
 		return
@@ -405,7 +530,7 @@ func (h *Handler) GetPostsByTag(c *gin.Context) {
 
 	totalPAges := int((total + int64(limit) - 1) / int64(limit))
 
-	c.HTML(http.StatusOK, "posts.html", gin.H{
+	h.render(c, http.StatusOK, "posts.html", gin.H{
 		"posts":       posts,
 		"currentPage": page,
 		"totalPages":  totalPAges,
@@ -413,32 +538,15 @@ func (h *Handler) GetPostsByTag(c *gin.Context) {
 		"hasPrev":     page > 1,
 		"title":       fmt.Sprintf("Posts tagged: %s", tagName),
 		"tag":         tagName,
-	})
-}
-
-func (h *Handler) RSS(c *gin.Context) {
-	var posts []models.Post
-
-	result := h.DB.Where("published = ?", true).
-		Order("created_at DESC").
-		Limit(20).
-		Find(&posts)
-
-	if result.Error != nil {
-		c.String(http.StatusInternalServerError, "Error generating RSS feed")
-		return
-	}
-
-	c.Header("Content-Type", "application/rss+xml")
-	c.HTML(http.StatusOK, "rss.xml", gin.H{
-		"posts":     posts,
-		"buildDate": time.Now().Format(time.RFC1123Z),
+		"hFeed":       h.hFeed(fmt.Sprintf("Posts tagged: %s", tagName), "/tags/"+url.PathEscape(tagName), posts),
+		"feeds": append(feedLinks(fmt.Sprintf("Posts tagged %s", tagName), "/tags/"+url.PathEscape(tagName)+"/feed"),
+			siteFeedLinks(h.Settings.Get().Title)...),
 	})
 }
 
 func (h *Handler) GetPosts(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit := 10
+	limit := h.Settings.Get().PostsPerPage
 	offset := (page - 1) * limit
 
 	var posts []models.Post
@@ -448,13 +556,14 @@ func (h *Handler) GetPosts(c *gin.Context) {
 
 	result := h.DB.Where("published = ?", true).
 		Preload("Tags").
+		Preload("Author").
 		Order("created_at DESC").
 		Limit(limit).
 		Offset(offset).
 		Find(&posts)
 
 	if result.Error != nil {
-		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
 			"error": "Failed to load posts",
 		})
 		return
@@ -462,42 +571,179 @@ func (h *Handler) GetPosts(c *gin.Context) {
 
 	totalPages := int((total + int64(limit) - 1) / int64(limit))
 
-	c.HTML(http.StatusOK, "posts.html", gin.H{
+	h.render(c, http.StatusOK, "posts.html", gin.H{
 		"posts":       posts,
 		"currentPage": page,
 		"totalPages":  totalPages,
 		"hasNext":     page < totalPages,
 		"hasPrev":     page > 1,
 		"title":       "All Posts",
+		"hFeed":       h.hFeed("All Posts", "/posts", posts),
 	})
 }
 func (h *Handler) GetPost(c *gin.Context) {
 	slug := c.Param("slug")
 	var post models.Post
 
-	result := h.DB.Where("slug = ? AND published = ?", slug, true).Preload("Tags").First(&post)
+	result := h.DB.Where("slug = ? AND published = ?", slug, true).
+		Preload("Tags").
+		Preload("Category").
+		Preload("FeaturedImage").
+		Preload("Author").
+		First(&post)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			c.HTML(http.StatusNotFound, "404.html", gin.H{
+			h.render(c, http.StatusNotFound, "404.html", gin.H{
 				"message": "Post Not Found",
 			})
 			return
 		}
-		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
 			"error": "Failed to load post",
 		})
 		return
 	}
 
-	c.HTML(http.StatusOK, "post.html", gin.H{
-		"post":  post,
-		"title": post.Title,
-	})
+	if wantsActivity(c) {
+		article := h.apArticle(post)
+		article["@context"] = activitypub.Context
+		h.activityJSON(c, http.StatusOK, article)
+		return
+	}
+
+	meta := h.postMeta(post)
+	post.Content = h.responsiveImages(post.Content)
+
+	data := h.commentsData(post)
+	data["post"] = post
+	data["meta"] = meta
+	data["title"] = post.Title
+	data["breadcrumbs"] = h.categoryBreadcrumbs(post.Category)
+	data["seriesNav"] = h.seriesNavigation(post)
+	data["hEntry"] = h.hEntry(post)
+	data["webmentions"] = h.postMentions(post.ID)
+
+	endpoint := h.Settings.Get().URL("/webmention")
+	data["webmentionEndpoint"] = endpoint
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="webmention"`, endpoint))
+
+	h.render(c, http.StatusOK, "post.html", data)
 
 }
 
 // Helper functions
 
+// createPost saves a new post with the named tags, then updates everything
+// that depends on posts, fires the webhooks and announces it if it is
+// published. The admin form and Micropub both create posts through it.
+func (h *Handler) createPost(post *models.Post, tagNames []string) error {
+	post.Tags = h.tagsByName(tagNames)
+
+	if err := h.DB.Create(post).Error; err != nil {
+		return err
+	}
+	h.invalidateNav()
+	if err := h.syncMediaUsage(*post); err != nil {
+		log.Printf("Failed to index media usage of post %d: %v", post.ID, err)
+	}
+	h.postEvent(models.EventPostCreated, *post)
+	if post.Published {
+		h.postEvent(models.EventPostPublished, *post)
+	}
+	h.notifyPublished(*post)
+	return nil
+}
+
+// deletePost removes a post along with its associations
+func (h *Handler) deletePost(post models.Post) error {
+	// taken before the tags are gone
+	payload := h.webhookPost(post)
+
+	h.DB.Model(&post).Association("Tags").Clear()
+	h.DB.Where("post_id = ?", post.ID).Delete(&models.MediaUsage{})
+	h.DB.Where("post_id = ?", post.ID).Delete(&models.Comment{})
+	h.DB.Where("post_id = ?", post.ID).Delete(&models.Webmention{})
+
+	if err := h.DB.Delete(&post).Error; err != nil {
+		return err
+	}
+	if post.SocialCardKey != "" {
+		h.Storage.Delete(context.Background(), post.SocialCardKey)
+	}
+	h.invalidateNav()
+	h.fireWebhooks(models.EventPostDeleted, payload)
+	if post.Published {
+		h.federate(activityDelete, post)
+	}
+	return nil
+}
+
+// tagsByName finds the tags with the given names, creating those that do not exist yet
+func (h *Handler) tagsByName(names []string) []models.Tag {
+	var tags []models.Tag
+	for _, tagName := range names {
+		if tagName != "" {
+			var tag models.Tag
+			result := h.DB.Where("name = ?", tagName).First(&tag)
+			if result.Error == gorm.ErrRecordNotFound {
+				tag = models.Tag{Name: tagName}
+				h.DB.Create(&tag)
+			}
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// postByURL finds the post a permalink on this site points at, published or not
+func (h *Handler) postByURL(raw string) (models.Post, bool) {
+	var post models.Post
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return post, false
+	}
+	base, err := url.Parse(h.Settings.Get().BaseURL)
+	if err != nil || !strings.EqualFold(u.Host, base.Host) {
+		return post, false
+	}
+
+	slug, ok := strings.CutPrefix(strings.TrimSuffix(u.Path, "/"), "/posts/")
+	if !ok || slug == "" || strings.Contains(slug, "/") {
+		return post, false
+	}
+
+	err = h.DB.Where("slug = ?", slug).First(&post).Error
+	return post, err == nil
+}
+
+func (h *Handler) publishedPostByURL(raw string) (models.Post, bool) {
+	post, ok := h.postByURL(raw)
+	return post, ok && post.Published
+}
+
+// uniquePostSlug derives a slug from base that no other post uses yet
+func (h *Handler) uniquePostSlug(base string, selfID uint) string {
+	slug := generateSlug(base)
+	if slug == "" {
+		slug = "post"
+	}
+	taken := func(candidate string) bool {
+		var existing models.Post
+		return h.DB.Where("slug = ? AND id <> ?", candidate, selfID).First(&existing).Error == nil
+	}
+
+	if !taken(slug) {
+		return slug
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", slug, i)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
 func generateSlug(title string) string {
 	// Simple slug generation - you might want to use a proper library
 	slug := strings.ToLower(title)
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"RustyBits/internals/feed"
+	"RustyBits/internals/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// feedSummaryLength is where summaries derived from content are cut off
+const feedSummaryLength = 300
+
+// feedTypes maps the format query parameter of a feed to its content type
+var feedTypes = map[string]string{
+	"atom": "application/atom+xml",
+	"json": "application/feed+json",
+	"rss":  "application/rss+xml",
+}
+
+// FeedLink is a feed advertised with <link rel="alternate"> for discovery
+type FeedLink struct {
+	Title string
+	Type  string
+	URL   string
+}
+
+// Feed is the site wide feed, Atom by default or JSON Feed and RSS with ?format=json and ?format=rss
+func (h *Handler) Feed(c *gin.Context) {
+	h.siteFeed(c, "/feed", c.DefaultQuery("format", "atom"))
+}
+
+// RSS is the site wide feed at its historical address
+func (h *Handler) RSS(c *gin.Context) {
+	h.siteFeed(c, "/rss", "rss")
+}
+
+func (h *Handler) TagFeed(c *gin.Context) {
+	tagName := c.Param("tag")
+
+	var tag models.Tag
+	if err := h.DB.Where("name = ?", tagName).First(&tag).Error; err != nil {
+		c.String(http.StatusNotFound, "Tag not found")
+		return
+	}
+
+	site := h.Settings.Get()
+	path := "/tags/" + url.PathEscape(tag.Name)
+
+	h.postFeed(c, feed.Feed{
+		Title:       fmt.Sprintf("%s: posts tagged %s", site.Title, tag.Name),
+		Description: site.Tagline,
+		Link:        site.URL(path),
+	}, path+"/feed", c.DefaultQuery("format", "atom"), h.DB.Where("published = ? AND id IN (?)", true,
+		h.DB.Table("post_tags").Select("post_id").Where("tag_id = ?", tag.ID)))
+}
+
+func (h *Handler) AuthorFeed(c *gin.Context) {
+	var author models.User
+	if err := h.DB.Select("id, name").First(&author, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, "Author not found")
+		return
+	}
+
+	site := h.Settings.Get()
+	name := firstNonEmpty(author.Name, site.DefaultAuthor)
+
+	h.postFeed(c, feed.Feed{
+		Title:       fmt.Sprintf("%s: posts by %s", site.Title, name),
+		Description: site.Tagline,
+		Link:        site.URL("/"),
+		Author:      name,
+	}, fmt.Sprintf("/authors/%d/feed", author.ID), c.DefaultQuery("format", "atom"), h.DB.Where("published = ? AND author_id = ?", true, author.ID))
+}
+
+// Feed helpers
+
+func (h *Handler) siteFeed(c *gin.Context, path, format string) {
+	site := h.Settings.Get()
+
+	h.postFeed(c, feed.Feed{
+		Title:       site.Title,
+		Description: site.Tagline,
+		Link:        site.URL("/"),
+	}, path, format, h.DB.Where("published = ?", true))
+}
+
+// postFeed fills f with the newest posts matching query and serves it in
+// format. path is where the feed itself lives.
+func (h *Handler) postFeed(c *gin.Context, f feed.Feed, path, format string, query *gorm.DB) {
+	contentType, ok := feedTypes[format]
+	if !ok {
+		c.String(http.StatusBadRequest, "Unknown feed format")
+		return
+	}
+
+	site := h.Settings.Get()
+
+	full := site.FeedFullText
+	switch c.Query("content") {
+	case "full":
+		full = true
+	case "summary":
+		full = false
+	}
+
+	var posts []models.Post
+	result := query.Preload("Tags").
+		Preload("Author").
+		Preload("FeaturedImage").
+		Order("created_at DESC").
+		Limit(site.FeedLength).
+		Find(&posts)
+	if result.Error != nil {
+		c.String(http.StatusInternalServerError, "Error generating feed")
+		return
+	}
+
+	self := url.Values{}
+	if c.Query("format") != "" {
+		self.Set("format", format)
+	}
+	if c.Query("content") != "" {
+		self.Set("content", c.Query("content"))
+	}
+	f.FeedURL = site.URL(path)
+	if len(self) > 0 {
+		f.FeedURL += "?" + self.Encode()
+	}
+	if f.Author == "" {
+		f.Author = site.DefaultAuthor
+	}
+	f.Hub = site.WebSubHub
+	f.Items = h.feedItems(posts, full)
+
+	var body []byte
+	var err error
+	switch format {
+	case "json":
+		body, err = f.JSON()
+	case "rss":
+		body, err = f.RSS()
+	default:
+		body, err = f.Atom()
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Error generating feed")
+		return
+	}
+
+	// WebSub discovery works from the headers too, for readers that do not parse the body
+	if f.Hub != "" {
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`, f.Hub, f.FeedURL))
+	}
+
+	serveFeed(c, contentType, body, f.LastModified())
+}
+
+// feedItems converts posts to feed items with absolute links. Without full
+// content only the summary is published.
+func (h *Handler) feedItems(posts []models.Post, full bool) []feed.Item {
+	site := h.Settings.Get()
+
+	items := make([]feed.Item, 0, len(posts))
+	for _, post := range posts {
+		link := site.URL("/posts/" + post.Slug)
+		item := feed.Item{
+			ID:        link,
+			Title:     post.Title,
+			Link:      link,
+			Summary:   firstNonEmpty(post.MetaDescription, post.Excerpt, plainText(post.Content, feedSummaryLength)),
+			Author:    h.authorName(post),
+			Published: post.CreatedAt,
+			Updated:   post.UpdatedAt,
+		}
+		if full {
+			item.Content = absoluteLinks(h.responsiveImages(post.Content), site.URL("/"))
+		}
+		if post.FeaturedImage != nil && !post.FeaturedImage.Private {
+			item.Image = absoluteURL(site, h.Storage.URL(post.FeaturedImage.Path))
+		}
+		for _, tag := range post.Tags {
+			item.Categories = append(item.Categories, tag.Name)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// authorName is who a post is credited to, the site default for posts without a named author
+func (h *Handler) authorName(post models.Post) string {
+	if post.Author != nil && post.Author.Name != "" {
+		return post.Author.Name
+	}
+	return h.Settings.Get().DefaultAuthor
+}
+
+// feedLinks are the discovery links for the feed at path, in every format
+func feedLinks(title, path string) []FeedLink {
+	return []FeedLink{
+		{Title: title + " (RSS)", Type: feedTypes["rss"], URL: path + "?format=rss"},
+		{Title: title + " (Atom)", Type: feedTypes["atom"], URL: path + "?format=atom"},
+		{Title: title + " (JSON Feed)", Type: feedTypes["json"], URL: path + "?format=json"},
+	}
+}
+
+// siteFeedLinks are the feeds every page advertises
+func siteFeedLinks(title string) []FeedLink {
+	links := feedLinks(title, "/feed")
+	links[0].URL = "/rss"
+	links[1].URL = "/feed"
+	return links
+}
+
+// serveFeed writes a feed with validators so readers can poll with
+// conditional requests and get 304 Not Modified while nothing changed
+func serveFeed(c *gin.Context, contentType string, body []byte, lastModified time.Time) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+
+	if notModified(c, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType+"; charset=utf-8", body)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is no
+// entity tag to compare, as RFC 9110 orders them
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := c.GetHeader("If-Modified-Since"); since != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+var rootRelativePattern = regexp.MustCompile(`(?i)(\s(?:src|href|poster)\s*=\s*["'])/([^/"'][^"']*)`)
+
+// absoluteLinks rewrites root relative links in content against base, since
+// feed readers show content away from the site
+func absoluteLinks(content, base string) string {
+	base = strings.TrimRight(base, "/")
+	rewritten := rootRelativePattern.ReplaceAllString(content, "${1}"+strings.ReplaceAll(base, "$", "$$")+"/${2}")
+
+	// srcset holds several urls, each of which may be root relative
+	return srcsetValuePattern.ReplaceAllStringFunc(rewritten, func(attr string) string {
+		return srcsetURLPattern.ReplaceAllString(attr, "${1}"+strings.ReplaceAll(base, "$", "$$")+"/${2}")
+	})
+}
+
+var (
+	srcsetValuePattern = regexp.MustCompile(`(?i)\ssrcset\s*=\s*"[^"]*"`)
+	srcsetURLPattern   = regexp.MustCompile(`((?:^|[",])\s*)/([^/\s,"][^\s,"]*)`)
+)
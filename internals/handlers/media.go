@@ -0,0 +1,661 @@
+package handlers
+
+import (
+	"RustyBits/internals/media"
+	"RustyBits/internals/models"
+	"RustyBits/internals/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxFilesPerUpload caps how many files a single drag-and-drop request may carry
+const maxFilesPerUpload = 10
+
+// mediaPageSize is how many files the library grid shows per page
+const mediaPageSize = 48
+
+// mediaTypes maps the type filter of the library to mime type patterns
+var mediaTypes = map[string][]string{
+	"image":    {"image/%"},
+	"video":    {"video/%"},
+	"audio":    {"audio/%", "application/ogg"},
+	"document": {"application/pdf"},
+}
+
+// AdminMedia is the media library grid. It filters by type, uploader and
+// upload date and searches file names and alt text; HTMX requests get just the grid.
+func (h *Handler) AdminMedia(c *gin.Context) {
+	data, err := h.mediaLibrary(c, true)
+	if err != nil {
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load media",
+		})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		h.render(c, http.StatusOK, "admin/media-grid.html", data)
+		return
+	}
+
+	var uploaders []models.User
+	h.DB.Select("id, email").
+		Where("id IN (?)", h.DB.Model(&models.Media{}).Select("uploader_id")).
+		Order("email ASC").
+		Find(&uploaders)
+
+	data["uploaders"] = uploaders
+	data["types"] = []string{"image", "video", "audio", "document"}
+	data["title"] = "Media"
+	h.render(c, http.StatusOK, "admin/media.html", data)
+}
+
+// MediaPicker is the library as opened from the post form. Private files are
+// left out since they can not be embedded in public content.
+func (h *Handler) MediaPicker(c *gin.Context) {
+	data, err := h.mediaLibrary(c, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.render(c, http.StatusOK, "admin/media-picker.html", data)
+}
+
+// MediaSnippet returns the markup that embeds a file in post content. HTMX
+// requests receive it in a mediaInsert event for the editor to insert at the cursor.
+func (h *Handler) MediaSnippet(c *gin.Context) {
+	var item models.Media
+	if err := h.DB.Preload("Variants").First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media Not Found"})
+		return
+	}
+	if item.Private {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "private files can not be embedded in posts"})
+		return
+	}
+
+	width, _ := strconv.Atoi(c.Query("width"))
+	markup := h.mediaMarkup(item, width, c.Query("caption"))
+
+	if c.GetHeader("HX-Request") == "true" {
+		event, err := json.Marshal(gin.H{"mediaInsert": gin.H{"markup": markup}})
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Header("HX-Trigger", string(event))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"markup": markup})
+}
+
+// MediaUsage lists the posts that embed a file
+func (h *Handler) MediaUsage(c *gin.Context) {
+	var item models.Media
+	if err := h.DB.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media Not Found"})
+		return
+	}
+
+	usage := h.mediaUsage([]uint{item.ID})[item.ID]
+
+	if c.GetHeader("HX-Request") == "true" {
+		h.render(c, http.StatusOK, "admin/media-usage.html", gin.H{"item": item, "posts": usage})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"posts": postRefs(usage)})
+}
+
+// UploadMedia accepts one or more files in the "file" field of a multipart form
+func (h *Handler) UploadMedia(c *gin.Context) {
+	maxBytes := int64(h.Settings.Get().MaxUploadMB) << 20
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes*maxFilesPerUpload+(1<<20))
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or oversized upload"})
+		return
+	}
+
+	headers := form.File["file"]
+	if len(headers) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file uploaded"})
+		return
+	}
+	if len(headers) > maxFilesPerUpload {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d files per upload", maxFilesPerUpload)})
+		return
+	}
+
+	uploaderID := c.GetUint("user_id")
+	altText := strings.TrimSpace(c.PostForm("alt_text"))
+	private := c.PostForm("private") == "true" || c.PostForm("private") == "on"
+
+	var uploaded []models.Media
+	for _, header := range headers {
+		if header.Size > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("%s is larger than %d MB", header.Filename, maxBytes>>20),
+			})
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if int64(len(data)) > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("%s is larger than %d MB", header.Filename, maxBytes>>20),
+			})
+			return
+		}
+
+		item, err := h.storeMedia(c.Request.Context(), data, header.Filename, altText, uploaderID, private)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, media.ErrUnsupportedType):
+				status = http.StatusUnsupportedMediaType
+			case errors.Is(err, media.ErrImageTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.JSON(status, gin.H{"error": fmt.Sprintf("%s: %v", header.Filename, err)})
+			return
+		}
+		uploaded = append(uploaded, *item)
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "mediaUploaded")
+		h.render(c, http.StatusOK, "admin/media-items.html", gin.H{"media": uploaded})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"media": uploaded})
+}
+
+func (h *Handler) UpdateMedia(c *gin.Context) {
+	var item models.Media
+	if err := h.DB.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media Not Found"})
+		return
+	}
+
+	item.AltText = strings.TrimSpace(c.PostForm("alt_text"))
+	if err := h.DB.Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "mediaUpdated")
+		h.render(c, http.StatusOK, "admin/media-item.html", gin.H{"item": item})
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+func (h *Handler) DeleteMedia(c *gin.Context) {
+	var item models.Media
+	if err := h.DB.First(&item, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if posts := h.mediaUsage([]uint{item.ID})[item.ID]; len(posts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "file is still used by posts",
+			"posts": postRefs(posts),
+		})
+		return
+	}
+
+	var variants []models.MediaVariant
+	h.DB.Where("media_id = ?", item.ID).Find(&variants)
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", item.ID).Delete(&models.MediaVariant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&item).Error
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	keys := []string{item.Path}
+	for _, variant := range variants {
+		keys = append(keys, variant.Path)
+	}
+	for _, key := range keys {
+		if err := h.Storage.Delete(c.Request.Context(), key); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "mediaDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Media helpers
+
+// storeMedia sniffs, stores and records an upload. Identical content with the
+// same visibility resolves to the existing record instead of a second copy.
+func (h *Handler) storeMedia(ctx context.Context, data []byte, fileName, altText string, uploaderID uint, private bool) (item *models.Media, err error) {
+	file, err := media.Inspect(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing models.Media
+	err = h.DB.Where("hash = ? AND private = ?", file.Hash, private).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	widths, err := h.Settings.Get().ImageWidthList()
+	if err != nil {
+		return nil, err
+	}
+	variants, err := file.Process(widths)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if private {
+		prefix = storage.PrivatePrefix
+	}
+
+	// nothing stored may outlive a failed upload, or it would never be cleaned up
+	var stored []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, key := range stored {
+			if err := h.Storage.Delete(context.WithoutCancel(ctx), key); err != nil {
+				log.Printf("Failed to remove %s after a failed upload: %v", key, err)
+			}
+		}
+	}()
+
+	if err := h.Storage.Put(ctx, prefix+file.Path(), file.Data, file.MimeType); err != nil {
+		return nil, err
+	}
+	stored = append(stored, prefix+file.Path())
+
+	record := models.Media{
+		Hash:       file.Hash,
+		Path:       prefix + file.Path(),
+		FileName:   fileName,
+		MimeType:   file.MimeType,
+		Size:       int64(len(file.Data)),
+		Width:      file.Width,
+		Height:     file.Height,
+		AltText:    altText,
+		UploaderID: uploaderID,
+		Private:    private,
+	}
+	for _, variant := range variants {
+		path := prefix + file.VariantPath(variant.Width)
+		if err := h.Storage.Put(ctx, path, variant.Data, file.MimeType); err != nil {
+			return nil, err
+		}
+		stored = append(stored, path)
+		record.Variants = append(record.Variants, models.MediaVariant{
+			Width:  variant.Width,
+			Height: variant.Height,
+			Path:   path,
+			Size:   int64(len(variant.Data)),
+		})
+	}
+
+	if err := h.DB.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// mediaLibrary loads one page of the library for the filters in the query string
+func (h *Handler) mediaLibrary(c *gin.Context, includePrivate bool) (gin.H, error) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+
+	query := h.DB.Model(&models.Media{})
+
+	mediaType := c.Query("type")
+	if patterns, ok := mediaTypes[mediaType]; ok {
+		cond := h.DB
+		for _, pattern := range patterns {
+			cond = cond.Or("mime_type LIKE ?", pattern)
+		}
+		query = query.Where(cond)
+	}
+
+	uploaderID := parseOptionalID(c.Query("uploader"))
+	if uploaderID != nil {
+		query = query.Where("uploader_id = ?", *uploaderID)
+	}
+
+	// dates are whole days in the site timezone, both ends inclusive
+	loc := h.Settings.Get().Location()
+	from := c.Query("from")
+	if t, err := time.ParseInLocation("2006-01-02", from, loc); err == nil {
+		query = query.Where("created_at >= ?", t)
+	}
+	to := c.Query("to")
+	if t, err := time.ParseInLocation("2006-01-02", to, loc); err == nil {
+		query = query.Where("created_at < ?", t.AddDate(0, 0, 1))
+	}
+
+	search := strings.TrimSpace(c.Query("q"))
+	if search != "" {
+		like := "%" + search + "%"
+		query = query.Where("file_name LIKE ? OR alt_text LIKE ?", like, like)
+	}
+
+	if !includePrivate {
+		query = query.Where("private = ?", false)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	var items []models.Media
+	err := query.Order("created_at DESC").
+		Limit(mediaPageSize).
+		Offset((page - 1) * mediaPageSize).
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(items))
+	urls := make(map[uint]string, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+		urls[item.ID] = h.mediaURL(item)
+	}
+
+	totalPages := int((total + mediaPageSize - 1) / mediaPageSize)
+
+	return gin.H{
+		"media":       items,
+		"urls":        urls,
+		"usage":       h.mediaUsage(ids),
+		"total":       total,
+		"currentPage": page,
+		"totalPages":  totalPages,
+		"hasNext":     page < totalPages,
+		"hasPrev":     page > 1,
+		"filter": gin.H{
+			"type":     mediaType,
+			"uploader": uploaderID,
+			"from":     from,
+			"to":       to,
+			"q":        search,
+		},
+	}, nil
+}
+
+// mediaUsage maps each of the given files to the posts embedding it
+func (h *Handler) mediaUsage(ids []uint) map[uint][]models.Post {
+	usage := make(map[uint][]models.Post, len(ids))
+	if len(ids) == 0 {
+		return usage
+	}
+
+	var rows []models.MediaUsage
+	h.DB.Preload("Post", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id, title, slug, published")
+	}).Where("media_id IN ?", ids).Find(&rows)
+
+	for _, row := range rows {
+		if row.Post != nil {
+			usage[row.MediaID] = append(usage[row.MediaID], *row.Post)
+		}
+	}
+	return usage
+}
+
+// postRefs trims posts down to what a json client needs to link to them
+func postRefs(posts []models.Post) []gin.H {
+	refs := make([]gin.H, 0, len(posts))
+	for _, post := range posts {
+		refs = append(refs, gin.H{"id": post.ID, "title": post.Title, "slug": post.Slug})
+	}
+	return refs
+}
+
+var embedPattern = regexp.MustCompile(`(?i)\s(?:src|href|poster)\s*=\s*["']([^"']+)["']`)
+
+// syncMediaUsage rebuilds the usage rows of a post from its featured image and
+// the files its content embeds, whether as the original or a resized variant
+func (h *Handler) syncMediaUsage(post models.Post) error {
+	var keys []string
+	for _, match := range embedPattern.FindAllStringSubmatch(post.Content, -1) {
+		if key, ok := h.Storage.Key(html.UnescapeString(match[1])); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	var ids []uint
+	if len(keys) > 0 {
+		err := h.DB.Model(&models.Media{}).
+			Where("path IN ?", keys).
+			Or("id IN (?)", h.DB.Model(&models.MediaVariant{}).Select("media_id").Where("path IN ?", keys)).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if post.FeaturedImageID != nil && !slices.Contains(ids, *post.FeaturedImageID) {
+		ids = append(ids, *post.FeaturedImageID)
+	}
+
+	return h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("post_id = ?", post.ID).Delete(&models.MediaUsage{}).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := tx.Create(&models.MediaUsage{MediaID: id, PostID: post.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// rebuildMediaUsage fills the usage table for posts saved before it existed.
+// It only runs while the table is empty.
+func (h *Handler) rebuildMediaUsage() {
+	var count int64
+	if err := h.DB.Model(&models.MediaUsage{}).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+
+	var posts []models.Post
+	h.DB.Select("id, content, featured_image_id").Find(&posts)
+	for _, post := range posts {
+		if err := h.syncMediaUsage(post); err != nil {
+			log.Printf("Failed to index media usage of post %d: %v", post.ID, err)
+			return
+		}
+	}
+}
+
+// mediaMarkup is the html that embeds a file: an image, a player, or a
+// download link. width picks a resized variant of an image.
+func (h *Handler) mediaMarkup(item models.Media, width int, caption string) string {
+	src := html.EscapeString(h.Storage.URL(item.Path))
+	alt := html.EscapeString(item.AltText)
+
+	var markup string
+	switch {
+	case media.IsImage(item.MimeType):
+		w, ht := item.Width, item.Height
+		for _, variant := range item.Variants {
+			if variant.Width == width {
+				src = html.EscapeString(h.Storage.URL(variant.Path))
+				w, ht = variant.Width, variant.Height
+			}
+		}
+		if w > 0 && ht > 0 {
+			markup = fmt.Sprintf(`<img src="%s" alt="%s" width="%d" height="%d" loading="lazy">`, src, alt, w, ht)
+		} else {
+			markup = fmt.Sprintf(`<img src="%s" alt="%s" loading="lazy">`, src, alt)
+		}
+	case strings.HasPrefix(item.MimeType, "video/"):
+		markup = fmt.Sprintf(`<video controls preload="metadata" src="%s"></video>`, src)
+	case strings.HasPrefix(item.MimeType, "audio/"), item.MimeType == "application/ogg":
+		markup = fmt.Sprintf(`<audio controls preload="metadata" src="%s"></audio>`, src)
+	default:
+		markup = fmt.Sprintf(`<a href="%s">%s</a>`, src, html.EscapeString(item.FileName))
+	}
+
+	if caption = strings.TrimSpace(caption); caption != "" {
+		markup = fmt.Sprintf("<figure>%s<figcaption>%s</figcaption></figure>", markup, html.EscapeString(caption))
+	}
+	return markup
+}
+
+// privateMediaTTL is how long signed urls handed out for private files stay valid
+const privateMediaTTL = time.Hour
+
+// mediaURL is the address a file is reachable at: its public url, or a
+// short lived signed url for private files
+func (h *Handler) mediaURL(item models.Media) string {
+	if !item.Private {
+		return h.Storage.URL(item.Path)
+	}
+	signed, err := h.Storage.SignedURL(item.Path, privateMediaTTL)
+	if err != nil {
+		return ""
+	}
+	return signed
+}
+
+// ServeSignedMedia streams a file from local storage once the url signature
+// checks out. Other drivers hand out their own presigned urls instead.
+func (h *Handler) ServeSignedMedia(c *gin.Context) {
+	local, ok := h.Storage.(*storage.Local)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !local.Verify(key, c.Query("expires"), c.Query("signature")) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	file, err := local.Get(c.Request.Context(), key)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	contentType := "application/octet-stream"
+	var item models.Media
+	if err := h.DB.Select("mime_type").Where("path = ?", key).First(&item).Error; err == nil {
+		contentType = item.MimeType
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.DataFromReader(http.StatusOK, -1, contentType, file, nil)
+}
+
+var (
+	imgTagPattern = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	imgSrcPattern = regexp.MustCompile(`(?i)\ssrc\s*=\s*["']([^"']+)["']`)
+	srcsetPattern = regexp.MustCompile(`(?i)\ssrcset\s*=`)
+)
+
+// responsiveImages adds srcset and sizes to every <img> in content that points
+// at an upload with resized variants. Images that already carry a srcset are left alone.
+func (h *Handler) responsiveImages(content string) string {
+	sizes := h.Settings.Get().ImageSizes
+
+	return imgTagPattern.ReplaceAllStringFunc(content, func(tag string) string {
+		if srcsetPattern.MatchString(tag) {
+			return tag
+		}
+		match := imgSrcPattern.FindStringSubmatch(tag)
+		if match == nil {
+			return tag
+		}
+		path, ok := h.Storage.Key(html.UnescapeString(match[1]))
+		if !ok {
+			return tag
+		}
+
+		var item models.Media
+		if err := h.DB.Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("width ASC")
+		}).Where("path = ?", path).First(&item).Error; err != nil || len(item.Variants) == 0 {
+			return tag
+		}
+
+		candidates := make([]string, 0, len(item.Variants)+1)
+		for _, variant := range item.Variants {
+			candidates = append(candidates, fmt.Sprintf("%s %dw", h.Storage.URL(variant.Path), variant.Width))
+		}
+		candidates = append(candidates, fmt.Sprintf("%s %dw", h.mediaURL(item), item.Width))
+
+		attrs := fmt.Sprintf(` srcset="%s" sizes="%s"`,
+			html.EscapeString(strings.Join(candidates, ", ")),
+			html.EscapeString(sizes))
+
+		end := len(tag) - 1
+		if strings.HasSuffix(tag, "/>") {
+			end = len(tag) - 2
+		}
+		return strings.TrimRight(tag[:end], " ") + attrs + tag[end:]
+	})
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Admin menu builder
+
+func (h *Handler) AdminMenus(c *gin.Context) {
+	var menus []models.Menu
+	h.DB.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Where("parent_id IS NULL").Order("position ASC, id ASC")
+	}).Preload("Items.Children", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC, id ASC")
+	}).Order("name ASC").Find(&menus)
+
+	var pages []models.Page
+	h.DB.Order("title ASC").Find(&pages)
+
+	var posts []models.Post
+	h.DB.Where("published = ?", true).Order("created_at DESC").Find(&posts)
+
+	var tags []models.Tag
+	h.DB.Order("name ASC").Find(&tags)
+
+	h.render(c, http.StatusOK, "admin/menus.html", gin.H{
+		"allMenus": menus,
+		"pages":    pages,
+		"posts":    posts,
+		"tags":     tags,
+		"title":    "Menus",
+	})
+}
+
+func (h *Handler) CreateMenu(c *gin.Context) {
+	menu := models.Menu{Name: strings.TrimSpace(c.PostForm("name"))}
+	if menu.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	if err := h.DB.Create(&menu).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create menu"})
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "menuCreated")
+		h.render(c, http.StatusOK, "admin/menu.html", gin.H{"menu": menu})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/menus")
+}
+
+func (h *Handler) DeleteMenu(c *gin.Context) {
+	var menu models.Menu
+	if err := h.DB.First(&menu, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("menu_id = ?", menu.ID).Delete(&models.MenuItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&menu).Error
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "menuDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/menus")
+}
+
+func (h *Handler) CreateMenuItem(c *gin.Context) {
+	var menu models.Menu
+	if err := h.DB.First(&menu, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu Not Found"})
+		return
+	}
+
+	item := models.MenuItem{MenuID: menu.ID}
+	if err := h.bindMenuItem(c, &item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var last int
+	h.DB.Model(&models.MenuItem{}).
+		Where("menu_id = ? AND parent_id IS ?", menu.ID, item.ParentID).
+		Select("COALESCE(MAX(position), 0)").
+		Scan(&last)
+	item.Position = last + 1
+
+	if err := h.DB.Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create menu item"})
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "menuItemCreated")
+		h.render(c, http.StatusOK, "admin/menu-item.html", gin.H{"item": item})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/menus")
+}
+
+func (h *Handler) UpdateMenuItem(c *gin.Context) {
+	var item models.MenuItem
+	if err := h.DB.Where("menu_id = ?", c.Param("id")).First(&item, c.Param("itemID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu Item Not Found"})
+		return
+	}
+
+	if err := h.bindMenuItem(c, &item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "menuItemUpdated")
+		h.render(c, http.StatusOK, "admin/menu-item.html", gin.H{"item": item})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/menus")
+}
+
+func (h *Handler) DeleteMenuItem(c *gin.Context) {
+	var item models.MenuItem
+	if err := h.DB.Where("menu_id = ?", c.Param("id")).First(&item, c.Param("itemID")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("parent_id = ?", item.ID).Delete(&models.MenuItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&item).Error
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "menuItemDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/menus")
+}
+
+// ReorderMenu stores the order of one sortable list. Each list posts its item ids
+// in order, plus parent_id when it is the nested list under a top level item, so
+// dragging an item into another list also re-parents it.
+func (h *Handler) ReorderMenu(c *gin.Context) {
+	var menu models.Menu
+	if err := h.DB.First(&menu, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Menu Not Found"})
+		return
+	}
+
+	parentID := parseOptionalID(c.PostForm("parent_id"))
+	ids := c.PostFormArray("items")
+
+	if parentID != nil {
+		var parent models.MenuItem
+		if err := h.DB.Where("menu_id = ?", menu.ID).First(&parent, *parentID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown parent item"})
+			return
+		}
+		if h.menuItemWithin(parent, ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an item cannot be nested under itself or its children"})
+			return
+		}
+		if parent.ParentID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "menus can only be nested one level deep"})
+			return
+		}
+		var nestedParents int64
+		h.DB.Model(&models.MenuItem{}).Where("parent_id IN ?", ids).Count(&nestedParents)
+		if nestedParents > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an item with children cannot be nested"})
+			return
+		}
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			if err := tx.Model(&models.MenuItem{}).
+				Where("id = ? AND menu_id = ?", id, menu.ID).
+				Updates(map[string]any{"position": i + 1, "parent_id": parentID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "menuReordered")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/menus")
+}
+
+// Menu helpers
+
+// menuItemWithin reports whether item or one of its ancestors is among ids
+func (h *Handler) menuItemWithin(item models.MenuItem, ids []string) bool {
+	moved := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		moved[strings.TrimSpace(id)] = true
+	}
+
+	seen := map[uint]bool{}
+	for !seen[item.ID] {
+		if moved[strconv.FormatUint(uint64(item.ID), 10)] {
+			return true
+		}
+		seen[item.ID] = true
+		if item.ParentID == nil {
+			return false
+		}
+		var parent models.MenuItem
+		if err := h.DB.First(&parent, *item.ParentID).Error; err != nil {
+			return false
+		}
+		item = parent
+	}
+	return true
+}
+
+// isSitePath reports whether raw is a path on this site. "//host" and "/\host"
+// are read by browsers as another host, so they are not.
+func isSitePath(raw string) bool {
+	return strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") && !strings.Contains(raw, "\\")
+}
+
+func (h *Handler) bindMenuItem(c *gin.Context, item *models.MenuItem) error {
+	item.Label = strings.TrimSpace(c.PostForm("label"))
+	item.Kind = c.PostForm("kind")
+	item.TargetID = parseOptionalID(c.PostForm("target_id"))
+	item.URL = strings.TrimSpace(c.PostForm("url"))
+	item.ParentID = parseOptionalID(c.PostForm("parent_id"))
+
+	if item.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+
+	switch item.Kind {
+	case models.MenuItemPage, models.MenuItemPost, models.MenuItemTag:
+		if item.TargetID == nil {
+			return fmt.Errorf("a %s must be selected", item.Kind)
+		}
+		item.URL = ""
+	case models.MenuItemURL:
+		if item.URL == "" {
+			return fmt.Errorf("url is required")
+		}
+		if !isWebURL(item.URL) && !isSitePath(item.URL) {
+			return fmt.Errorf("url must be an absolute http(s) url or a path starting with /")
+		}
+		item.TargetID = nil
+	default:
+		return fmt.Errorf("unknown menu item kind %q", item.Kind)
+	}
+
+	if item.ParentID != nil {
+		if item.ID != 0 && *item.ParentID == item.ID {
+			return fmt.Errorf("an item cannot be its own parent")
+		}
+		var parent models.MenuItem
+		if err := h.DB.Where("menu_id = ?", item.MenuID).First(&parent, *item.ParentID).Error; err != nil {
+			return fmt.Errorf("unknown parent item")
+		}
+		if parent.ParentID != nil {
+			return fmt.Errorf("menus can only be nested one level deep")
+		}
+		if item.ID != 0 {
+			var children int64
+			h.DB.Model(&models.MenuItem{}).Where("parent_id = ?", item.ID).Count(&children)
+			if children > 0 {
+				return fmt.Errorf("an item with children cannot be nested")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMenuItemURLs(t *testing.T) {
+	h := newTestHandler(t)
+
+	for _, tt := range []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.com/about", true},
+		{"http://example.com", true},
+		{"/archive?year=2026", true},
+		{"javascript:alert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"//evil.example/", false},
+		{`/\evil.example/`, false},
+		{"mailto:ada@example.com", false},
+		{"archive", false},
+	} {
+		form := url.Values{"label": {"Link"}, "kind": {models.MenuItemURL}, "url": {tt.url}}
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		var item models.MenuItem
+		err := h.bindMenuItem(c, &item)
+		if (err == nil) != tt.ok {
+			t.Errorf("bindMenuItem(%q) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+
+		// the same goes for items stored before urls were checked
+		item = models.MenuItem{Label: "Link", Kind: models.MenuItemURL, URL: tt.url}
+		if _, ok := h.resolveMenuItem(item); ok != tt.ok {
+			t.Errorf("resolveMenuItem(%q) ok = %v, want %v", tt.url, ok, tt.ok)
+		}
+	}
+}
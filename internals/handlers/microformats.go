@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"time"
+)
+
+// HCard is the author of a post, marked up as an mf2 h-card with p-name and
+// u-url. The url is the site itself, as the author has no page of their own.
+type HCard struct {
+	Name string
+	URL  string
+}
+
+// HEntry is a post as an mf2 h-entry: p-name, u-url u-uid, dt-published,
+// dt-updated, p-summary, p-category for every tag and p-author h-card. The
+// post's content goes in e-content.
+type HEntry struct {
+	Name       string
+	URL        string
+	Published  time.Time
+	Updated    time.Time
+	Summary    string
+	Categories []string
+	Author     HCard
+}
+
+// HFeed is a list page as an mf2 h-feed, with an h-entry for every post
+type HFeed struct {
+	Name    string
+	URL     string
+	Author  HCard
+	Entries []HEntry
+}
+
+// hCard is the author of post, falling back to the site's default author
+func (h *Handler) hCard(post models.Post) HCard {
+	return HCard{
+		Name: h.authorName(post),
+		URL:  h.Settings.Get().URL("/"),
+	}
+}
+
+func (h *Handler) hEntry(post models.Post) HEntry {
+	entry := HEntry{
+		Name:      post.Title,
+		URL:       h.Settings.Get().URL("/posts/" + post.Slug),
+		Published: post.CreatedAt,
+		Updated:   post.UpdatedAt,
+		Summary:   firstNonEmpty(post.Excerpt, plainText(post.Content, metaDescriptionLength)),
+		Author:    h.hCard(post),
+	}
+	for _, tag := range post.Tags {
+		entry.Categories = append(entry.Categories, tag.Name)
+	}
+	return entry
+}
+
+// hFeed marks up the posts listed at path. The feed's author is the site's
+// default author, which entries by someone else override with their own.
+func (h *Handler) hFeed(name, path string, posts []models.Post) HFeed {
+	site := h.Settings.Get()
+
+	feed := HFeed{
+		Name:    name,
+		URL:     site.URL(path),
+		Author:  HCard{Name: site.DefaultAuthor, URL: site.URL("/")},
+		Entries: make([]HEntry, 0, len(posts)),
+	}
+	for _, post := range posts {
+		feed.Entries = append(feed.Entries, h.hEntry(post))
+	}
+	return feed
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"RustyBits/internals/mf2"
+	"RustyBits/internals/models"
+	"RustyBits/internals/settings"
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBs atomic.Int64
+
+// newTestHandler is a Handler on an empty in-memory database, with the site
+// at https://blog.example
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:handlers%d?mode=memory&cache=shared", testDBs.Add(1))), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Setting{}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := settings.NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := settings.Defaults()
+	site.Title = "Rusty Bits"
+	site.BaseURL = "https://blog.example"
+	site.DefaultAuthor = "Ada Admin"
+	if err := store.Update(site); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Handler{DB: db, Settings: store}
+}
+
+// entryData is an h-entry with the post's content, which list pages leave out
+type entryData struct {
+	HEntry
+	Content template.HTML
+}
+
+// mfTemplate marks up HEntry, HFeed and HCard the way the site's templates
+// are expected to
+var mfTemplate = template.Must(template.New("mf2").Funcs(template.FuncMap{
+	"iso":     func(t time.Time) string { return t.Format(time.RFC3339) },
+	"listing": func(entry HEntry) entryData { return entryData{HEntry: entry} },
+}).Parse(`
+{{define "card"}}<a class="p-author h-card" href="{{.URL}}">{{.Name}}</a>{{end}}
+
+{{define "entry"}}<article class="h-entry">
+  <h2 class="p-name"><a class="u-url u-uid" href="{{.URL}}">{{.Name}}</a></h2>
+  <time class="dt-published" datetime="{{iso .Published}}">{{.Published.Format "2 Jan 2006"}}</time>
+  <time class="dt-updated" datetime="{{iso .Updated}}"></time>
+  by {{template "card" .Author}}
+  <p class="p-summary">{{.Summary}}</p>
+  {{range .Categories}}<a class="p-category" href="/tags/{{.}}">{{.}}</a>{{end}}
+  {{with .Content}}<div class="e-content">{{.}}</div>{{end}}
+</article>{{end}}
+
+{{define "feed"}}<main class="h-feed">
+  <h1 class="p-name">{{.Name}}</h1>
+  <a class="u-url" href="{{.URL}}">permalink</a>
+  {{template "card" .Author}}
+  {{range .Entries}}{{template "entry" (listing .)}}{{end}}
+</main>{{end}}
+`))
+
+func testPosts() []models.Post {
+	return []models.Post{
+		{
+			ID:        1,
+			Title:     "Hello & <World>",
+			Slug:      "hello-world",
+			Content:   "<p>Body with <em>markup</em></p>",
+			Excerpt:   "A first post",
+			CreatedAt: time.Date(2026, 4, 1, 10, 30, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2026, 4, 2, 8, 0, 0, 0, time.UTC),
+			Tags:      []models.Tag{{Name: "go"}, {Name: "web"}},
+			Author:    &models.User{Name: "Grace"},
+		},
+		{
+			ID:        2,
+			Title:     "Second",
+			Slug:      "second",
+			Content:   "<p>No excerpt, so the summary is this text.</p>",
+			CreatedAt: time.Date(2026, 4, 3, 9, 0, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2026, 4, 3, 9, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func parseMF2(t *testing.T, name string, data any) *mf2.Data {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := mfTemplate.ExecuteTemplate(&buf, name, data); err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://blog.example/")
+	doc, err := mf2.Parse(&buf, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestHEntry(t *testing.T) {
+	h := newTestHandler(t)
+	post := testPosts()[0]
+
+	doc := parseMF2(t, "entry", entryData{h.hEntry(post), template.HTML(post.Content)})
+
+	entries := doc.Find("h-entry")
+	if len(entries) != 1 {
+		t.Fatalf("found %d h-entries", len(entries))
+	}
+	entry := entries[0]
+
+	checks := map[string]string{
+		"name":      "Hello & <World>",
+		"url":       "https://blog.example/posts/hello-world",
+		"uid":       "https://blog.example/posts/hello-world",
+		"published": "2026-04-01T10:30:00Z",
+		"updated":   "2026-04-02T08:00:00Z",
+		"summary":   "A first post",
+		"content":   "Body with markup",
+	}
+	for prop, want := range checks {
+		if got := entry.Get(prop); got != want {
+			t.Errorf("%s = %q, want %q", prop, got, want)
+		}
+	}
+
+	if got := strings.Join(entry.Strings("category"), ","); got != "go,web" {
+		t.Errorf("categories = %s", got)
+	}
+	if content, ok := entry.Properties["content"][0].(mf2.HTML); !ok || content.HTML != "<p>Body with <em>markup</em></p>" {
+		t.Errorf("e-content html = %#v", entry.Properties["content"][0])
+	}
+
+	author := entry.Item("author")
+	if author == nil || !author.HasType("h-card") {
+		t.Fatalf("author is not an h-card: %#v", entry.Properties["author"])
+	}
+	if author.Get("name") != "Grace" || author.Get("url") != "https://blog.example/" {
+		t.Errorf("author = %q at %q", author.Get("name"), author.Get("url"))
+	}
+}
+
+func TestHFeed(t *testing.T) {
+	h := newTestHandler(t)
+	doc := parseMF2(t, "feed", h.hFeed("All Posts", "/posts", testPosts()))
+
+	feeds := doc.Find("h-feed")
+	if len(feeds) != 1 {
+		t.Fatalf("found %d h-feeds", len(feeds))
+	}
+	feed := feeds[0]
+	if feed.Get("name") != "All Posts" || feed.Get("url") != "https://blog.example/posts" {
+		t.Errorf("feed = %q at %q", feed.Get("name"), feed.Get("url"))
+	}
+	if author := feed.Item("author"); author == nil || author.Get("name") != "Ada Admin" {
+		t.Errorf("feed author = %#v", feed.Properties["author"])
+	}
+
+	if len(feed.Children) != 2 {
+		t.Fatalf("feed has %d children", len(feed.Children))
+	}
+	first, second := feed.Children[0], feed.Children[1]
+	if !first.HasType("h-entry") || first.Get("name") != "Hello & <World>" || first.Item("author").Get("name") != "Grace" {
+		t.Errorf("first entry = %q by %q", first.Get("name"), first.Item("author").Get("name"))
+	}
+	// without an author of its own the entry is by the site's default author
+	if second.Get("url") != "https://blog.example/posts/second" || second.Item("author").Get("name") != "Ada Admin" {
+		t.Errorf("second entry = %q by %q", second.Get("url"), second.Item("author").Get("name"))
+	}
+	if second.Get("summary") != "No excerpt, so the summary is this text." {
+		t.Errorf("summary from content = %q", second.Get("summary"))
+	}
+	if second.Get("published") != "2026-04-03T09:00:00Z" {
+		t.Errorf("published = %q", second.Get("published"))
+	}
+}
+
+func TestHCard(t *testing.T) {
+	h := newTestHandler(t)
+
+	for _, tt := range []struct {
+		post models.Post
+		want string
+	}{
+		{testPosts()[0], "Grace"},
+		{testPosts()[1], "Ada Admin"},
+		{models.Post{Author: &models.User{Email: "nameless@example.com"}}, "Ada Admin"},
+	} {
+		doc := parseMF2(t, "card", h.hCard(tt.post))
+		cards := doc.Find("h-card")
+		if len(cards) != 1 {
+			t.Fatalf("found %d h-cards", len(cards))
+		}
+		if cards[0].Get("name") != tt.want || cards[0].Get("url") != "https://blog.example/" {
+			t.Errorf("h-card = %q at %q, want %q", cards[0].Get("name"), cards[0].Get("url"), tt.want)
+		}
+	}
+}
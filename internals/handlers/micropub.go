@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"RustyBits/internals/apitoken"
+	"RustyBits/internals/media"
+	"RustyBits/internals/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxMicropubJSON caps the size of a JSON Micropub request
+const maxMicropubJSON = 1 << 20
+
+// titleFromContentLength is how much of a note's text becomes its title
+const titleFromContentLength = 60
+
+// micropubRequest is a Micropub request in either encoding, brought into the
+// shape of the JSON one. Form encoded requests only ever create or delete.
+type micropubRequest struct {
+	Type       []string         `json:"type"`
+	Action     string           `json:"action"`
+	URL        string           `json:"url"`
+	Properties map[string][]any `json:"properties"`
+
+	Replace map[string][]any `json:"replace"`
+	Add     map[string][]any `json:"add"`
+	// Delete is either a list of property names or a map of values to remove
+	Delete any `json:"delete"`
+}
+
+// Micropub creates, updates and deletes posts for Micropub clients
+func (h *Handler) Micropub(c *gin.Context) {
+	req, err := h.parseMicropub(c)
+	if err != nil {
+		micropubError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	switch req.Action {
+	case "", "create":
+		h.micropubCreate(c, req)
+	case "update":
+		h.micropubUpdate(c, req)
+	case "delete":
+		h.micropubDelete(c, req)
+	case "undelete":
+		micropubError(c, http.StatusBadRequest, "invalid_request", "deleted posts are gone for good")
+	default:
+		micropubError(c, http.StatusBadRequest, "invalid_request", fmt.Sprintf("unknown action %q", req.Action))
+	}
+}
+
+// MicropubQuery answers the q=config, source, syndicate-to and category queries
+func (h *Handler) MicropubQuery(c *gin.Context) {
+	site := h.Settings.Get()
+
+	switch c.Query("q") {
+	case "config":
+		c.JSON(http.StatusOK, gin.H{
+			"media-endpoint": site.URL("/micropub/media"),
+			"syndicate-to":   []string{},
+			"q":              []string{"config", "source", "syndicate-to", "category"},
+			"post-types": []gin.H{
+				{"type": "note", "name": "Note"},
+				{"type": "article", "name": "Article"},
+				{"type": "photo", "name": "Photo"},
+			},
+		})
+	case "syndicate-to":
+		c.JSON(http.StatusOK, gin.H{"syndicate-to": []string{}})
+	case "category":
+		var names []string
+		query := h.DB.Model(&models.Tag{}).Order("name ASC")
+		if filter := c.Query("filter"); filter != "" {
+			query = query.Where("name LIKE ?", filter+"%")
+		}
+		query.Pluck("name", &names)
+		c.JSON(http.StatusOK, gin.H{"categories": names})
+	case "source":
+		post, ok := h.postByURL(c.Query("url"))
+		if !ok {
+			micropubError(c, http.StatusBadRequest, "invalid_request", "no post at that url")
+			return
+		}
+		h.DB.Model(&post).Association("Tags").Find(&post.Tags)
+
+		props := h.micropubProperties(post)
+		if wanted := c.QueryArray("properties[]"); len(wanted) > 0 || c.Query("properties") != "" {
+			wanted = append(wanted, c.QueryArray("properties")...)
+			filtered := make(map[string][]any)
+			for _, name := range wanted {
+				if values, ok := props[name]; ok {
+					filtered[name] = values
+				}
+			}
+			c.JSON(http.StatusOK, gin.H{"properties": filtered})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"type": []string{"h-entry"}, "properties": props})
+	default:
+		micropubError(c, http.StatusBadRequest, "invalid_request", "unsupported query")
+	}
+}
+
+// MicropubMedia stores a file uploaded to the media endpoint and answers
+// with its url
+func (h *Handler) MicropubMedia(c *gin.Context) {
+	if !requireScope(c, apitoken.ScopeMedia) {
+		return
+	}
+
+	maxBytes := int64(h.Settings.Get().MaxUploadMB) << 20
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+(1<<20))
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		micropubError(c, http.StatusBadRequest, "invalid_request", "no file uploaded")
+		return
+	}
+
+	url, err := h.storeMicropubFile(c, header)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, media.ErrUnsupportedType) {
+			status = http.StatusUnsupportedMediaType
+		}
+		micropubError(c, status, "invalid_request", err.Error())
+		return
+	}
+
+	c.Header("Location", url)
+	c.Status(http.StatusCreated)
+}
+
+// Micropub helpers
+
+func (h *Handler) micropubCreate(c *gin.Context, req micropubRequest) {
+	if !requireScope(c, apitoken.ScopeCreate) {
+		return
+	}
+	if len(req.Type) > 0 && req.Type[0] != "h-entry" {
+		micropubError(c, http.StatusBadRequest, "invalid_request", "only h-entry posts are supported")
+		return
+	}
+
+	post := models.Post{Published: true}
+	tags, err := applyMicropubProperties(&post, req.Properties)
+	if err != nil {
+		micropubError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if post.Title == "" {
+		micropubError(c, http.StatusBadRequest, "invalid_request", "a post needs a name or content")
+		return
+	}
+
+	post.Slug = h.uniquePostSlug(firstNonEmpty(micropubString(req.Properties["mp-slug"]), post.Title), 0)
+	if authorID := c.GetUint("user_id"); authorID != 0 {
+		post.AuthorID = &authorID
+	}
+
+	if err := h.createPost(&post, tags); err != nil {
+		micropubError(c, http.StatusInternalServerError, "server_error", "failed to create post")
+		return
+	}
+
+	c.Header("Location", h.Settings.Get().URL("/posts/"+post.Slug))
+	c.Status(http.StatusCreated)
+}
+
+// micropubUpdate applies the changes to the post's properties and writes the
+// result back, so every property is read and written in one place
+func (h *Handler) micropubUpdate(c *gin.Context, req micropubRequest) {
+	if !requireScope(c, apitoken.ScopeUpdate) {
+		return
+	}
+
+	if req.Replace == nil && req.Add == nil && req.Delete == nil {
+		micropubError(c, http.StatusBadRequest, "invalid_request", "an update needs replace, add or delete, sent as json")
+		return
+	}
+
+	post, ok := h.postByURL(req.URL)
+	if !ok {
+		micropubError(c, http.StatusBadRequest, "invalid_request", "no post at that url")
+		return
+	}
+	h.DB.Model(&post).Association("Tags").Find(&post.Tags)
+	wasPublished := post.Published
+
+	props := h.micropubProperties(post)
+	for name, values := range req.Replace {
+		props[name] = values
+	}
+	for name, values := range req.Add {
+		props[name] = append(props[name], values...)
+	}
+	switch deletes := req.Delete.(type) {
+	case nil:
+	case []any:
+		for _, name := range deletes {
+			if name, ok := name.(string); ok {
+				delete(props, name)
+			}
+		}
+	case map[string]any:
+		for name, values := range deletes {
+			removals, _ := values.([]any)
+			props[name] = removeValues(props[name], removals)
+		}
+	default:
+		micropubError(c, http.StatusBadRequest, "invalid_request", "delete must be a list or an object")
+		return
+	}
+
+	tags, err := applyMicropubProperties(&post, props)
+	if err != nil {
+		micropubError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if post.Title == "" {
+		micropubError(c, http.StatusBadRequest, "invalid_request", "a post needs a name or content")
+		return
+	}
+	if slug := micropubString(req.Replace["mp-slug"]); slug != "" {
+		post.Slug = h.uniquePostSlug(slug, post.ID)
+	}
+
+	h.DB.Model(&post).Association("Tags").Replace(h.tagsByName(tags))
+	if err := h.DB.Omit("Tags").Save(&post).Error; err != nil {
+		micropubError(c, http.StatusInternalServerError, "server_error", "failed to update post")
+		return
+	}
+	h.invalidateNav()
+	if err := h.syncMediaUsage(post); err != nil {
+		log.Printf("Failed to index media usage of post %d: %v", post.ID, err)
+	}
+	h.postEvent(models.EventPostUpdated, post)
+	h.notifyChanged(post, wasPublished)
+
+	c.Header("Location", h.Settings.Get().URL("/posts/"+post.Slug))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) micropubDelete(c *gin.Context, req micropubRequest) {
+	if !requireScope(c, apitoken.ScopeDelete) {
+		return
+	}
+
+	post, ok := h.postByURL(req.URL)
+	if !ok {
+		micropubError(c, http.StatusBadRequest, "invalid_request", "no post at that url")
+		return
+	}
+	if err := h.deletePost(post); err != nil {
+		micropubError(c, http.StatusInternalServerError, "server_error", "failed to delete post")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// parseMicropub reads a JSON, form encoded or multipart request. Files sent
+// as photo are stored and become photo urls.
+func (h *Handler) parseMicropub(c *gin.Context) (micropubRequest, error) {
+	var req micropubRequest
+
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, maxMicropubJSON)
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid json: %v", err)
+		}
+		if req.Properties == nil {
+			req.Properties = make(map[string][]any)
+		}
+		return req, nil
+	}
+
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		maxBytes := int64(h.Settings.Get().MaxUploadMB) << 20
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes*maxFilesPerUpload+(1<<20))
+		if _, err := c.MultipartForm(); err != nil {
+			return req, errors.New("invalid or oversized upload")
+		}
+	} else if err := c.Request.ParseForm(); err != nil {
+		return req, err
+	}
+
+	req.Properties = make(map[string][]any)
+	for key, values := range c.Request.PostForm {
+		name := strings.TrimSuffix(key, "[]")
+		switch name {
+		case "access_token":
+		case "h":
+			req.Type = []string{"h-" + values[0]}
+		case "action":
+			req.Action = values[0]
+		case "url":
+			req.URL = values[0]
+		default:
+			for _, v := range values {
+				req.Properties[name] = append(req.Properties[name], v)
+			}
+		}
+	}
+
+	if c.Request.MultipartForm != nil {
+		for _, key := range []string{"photo", "photo[]"} {
+			for _, header := range c.Request.MultipartForm.File[key] {
+				url, err := h.storeMicropubFile(c, header)
+				if err != nil {
+					return req, fmt.Errorf("%s: %v", header.Filename, err)
+				}
+				req.Properties["photo"] = append(req.Properties["photo"], url)
+			}
+		}
+	}
+
+	return req, nil
+}
+
+func (h *Handler) storeMicropubFile(c *gin.Context, header *multipart.FileHeader) (string, error) {
+	maxBytes := int64(h.Settings.Get().MaxUploadMB) << 20
+	if header.Size > maxBytes {
+		return "", fmt.Errorf("larger than %d MB", maxBytes>>20)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > maxBytes {
+		return "", fmt.Errorf("larger than %d MB", maxBytes>>20)
+	}
+
+	item, err := h.storeMedia(c.Request.Context(), data, header.Filename, "", c.GetUint("user_id"), false)
+	if err != nil {
+		return "", err
+	}
+	return absoluteURL(h.Settings.Get(), h.Storage.URL(item.Path)), nil
+}
+
+// micropubProperties is a post as the properties of an h-entry
+func (h *Handler) micropubProperties(post models.Post) map[string][]any {
+	status := "draft"
+	if post.Published {
+		status = "published"
+	}
+
+	props := map[string][]any{
+		"name":        {post.Title},
+		"content":     {map[string]any{"html": post.Content}},
+		"published":   {post.CreatedAt.Format(time.RFC3339)},
+		"post-status": {status},
+		"url":         {h.Settings.Get().URL("/posts/" + post.Slug)},
+		"mp-slug":     {post.Slug},
+	}
+	if post.Excerpt != "" {
+		props["summary"] = []any{post.Excerpt}
+	}
+	for _, tag := range post.Tags {
+		props["category"] = append(props["category"], tag.Name)
+	}
+	return props
+}
+
+// applyMicropubProperties sets the fields of post from h-entry properties and
+// returns the tag names. Photos are added to the end of the content. A note
+// without a name is titled with the start of its text, and a photo without
+// either with the photo's alt text or the day it was taken.
+func applyMicropubProperties(post *models.Post, props map[string][]any) ([]string, error) {
+	post.Title = strings.TrimSpace(micropubString(props["name"]))
+	post.Excerpt = micropubString(props["summary"])
+
+	post.Content = ""
+	if len(props["content"]) > 0 {
+		switch content := props["content"][0].(type) {
+		case string:
+			post.Content = textToHTML(content)
+		case map[string]any:
+			if markup, ok := content["html"].(string); ok {
+				post.Content = markup
+			} else if text, ok := content["value"].(string); ok {
+				post.Content = textToHTML(text)
+			}
+		}
+	}
+
+	hasPhoto, photoAlt := false, ""
+	for _, photo := range props["photo"] {
+		src, alt := "", ""
+		switch photo := photo.(type) {
+		case string:
+			src = photo
+		case map[string]any:
+			src, _ = photo["value"].(string)
+			alt, _ = photo["alt"].(string)
+		}
+		if src != "" {
+			post.Content += fmt.Sprintf(`<p><img src="%s" alt="%s"></p>`, html.EscapeString(src), html.EscapeString(alt))
+			hasPhoto, photoAlt = true, firstNonEmpty(photoAlt, alt)
+		}
+	}
+
+	if status := micropubString(props["post-status"]); status != "" {
+		post.Published = status != "draft"
+	}
+	if published := micropubString(props["published"]); published != "" {
+		t, err := time.Parse(time.RFC3339, published)
+		if err != nil {
+			return nil, fmt.Errorf("published must be an RFC 3339 date: %v", err)
+		}
+		post.CreatedAt = t
+	}
+
+	if post.Title == "" {
+		post.Title = plainText(post.Content, titleFromContentLength)
+	}
+	// a photo post is often just the photo, which has no text to use
+	if post.Title == "" && hasPhoto {
+		if photoAlt != "" {
+			post.Title = plainText(html.EscapeString(photoAlt), titleFromContentLength)
+		} else {
+			taken := post.CreatedAt
+			if taken.IsZero() {
+				taken = time.Now()
+			}
+			post.Title = "Photo, " + taken.Format("2 January 2006")
+		}
+	}
+
+	var tags []string
+	for _, value := range props["category"] {
+		if name, ok := value.(string); ok && strings.TrimSpace(name) != "" {
+			tags = append(tags, strings.TrimSpace(name))
+		}
+	}
+	return tags, nil
+}
+
+// micropubString is the first value of a property as text
+func micropubString(values []any) string {
+	if len(values) == 0 {
+		return ""
+	}
+	switch v := values[0].(type) {
+	case string:
+		return v
+	case map[string]any:
+		value, _ := v["value"].(string)
+		return value
+	}
+	return ""
+}
+
+// textToHTML turns plain text into paragraphs, blank lines separating them
+func textToHTML(text string) string {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>") + "</p>")
+		}
+	}
+	return b.String()
+}
+
+// removeValues drops the text values of a property that appear in removals
+func removeValues(values, removals []any) []any {
+	var kept []any
+	for _, v := range values {
+		text, isText := v.(string)
+		remove := false
+		for _, r := range removals {
+			if r, ok := r.(string); ok && isText && r == text {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// requireScope answers with insufficient_scope unless the request's token grants scope
+func requireScope(c *gin.Context, scope string) bool {
+	token, _ := c.Get("api_token")
+	if record, ok := token.(models.APIToken); ok && apitoken.HasScope(record.Scope, scope) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope", "scope": scope})
+	return false
+}
+
+func micropubError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Micropub clients posting a photo often send nothing else, as in
+// h=entry&photo=<file>
+func TestMicropubPhotoOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		props map[string][]any
+		want  string
+	}{
+		{"photo url from a form", map[string][]any{
+			"photo":     {"https://blog.example/media/ab/cd.jpg"},
+			"published": {"2026-05-04T18:00:00+02:00"},
+		}, "Photo, 4 May 2026"},
+		{"photo with alt text", map[string][]any{
+			"photo": {map[string]any{"value": "https://blog.example/media/ab/cd.jpg", "alt": " Sunset over <the> bay "}},
+		}, "Sunset over <the> bay"},
+		{"photo with content", map[string][]any{
+			"photo":   {"https://blog.example/media/ab/cd.jpg"},
+			"content": {"Look at this"},
+		}, "Look at this"},
+		{"photo with a name", map[string][]any{
+			"photo": {map[string]any{"value": "https://blog.example/media/ab/cd.jpg", "alt": "Sunset"}},
+			"name":  {"Evening"},
+		}, "Evening"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var post models.Post
+			if _, err := applyMicropubProperties(&post, tt.props); err != nil {
+				t.Fatal(err)
+			}
+			if post.Title != tt.want {
+				t.Errorf("title = %q, want %q", post.Title, tt.want)
+			}
+			if !strings.Contains(post.Content, `<img src="https://blog.example/media/ab/cd.jpg"`) {
+				t.Errorf("content = %q", post.Content)
+			}
+		})
+	}
+
+	// without a date the photo is titled with today's
+	var post models.Post
+	applyMicropubProperties(&post, map[string][]any{"photo": {"https://blog.example/media/ab/cd.jpg"}})
+	if want := "Photo, " + time.Now().Format("2 January 2006"); post.Title != want {
+		t.Errorf("title = %q, want %q", post.Title, want)
+	}
+
+	// a post with neither text nor a photo is still turned away
+	post = models.Post{}
+	applyMicropubProperties(&post, map[string][]any{"category": {"empty"}})
+	if post.Title != "" {
+		t.Errorf("empty post titled %q", post.Title)
+	}
+}
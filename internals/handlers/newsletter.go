@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/newsletter"
+	"RustyBits/internals/spam"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var subscriberStatuses = []string{models.SubscriberPending, models.SubscriberConfirmed, models.SubscriberUnsubscribed}
+
+var newsletterFrequencies = []string{models.FrequencyEachPost, models.FrequencyWeekly}
+
+func (h *Handler) NewsletterForm(c *gin.Context) {
+	h.render(c, http.StatusOK, "newsletter.html", gin.H{
+		"frequencies": newsletterFrequencies,
+		"title":       "Newsletter",
+	})
+}
+
+// Subscribe answers the same whether the address is new, pending or already
+// confirmed, so the form does not reveal who is subscribed
+func (h *Handler) Subscribe(c *gin.Context) {
+	email := c.PostForm("email")
+	frequency := c.DefaultPostForm("frequency", models.FrequencyEachPost)
+
+	// bots fill in the hidden field, tell them it worked and send nothing
+	if c.PostForm(spam.HoneypotField) == "" {
+		if err := h.Newsletter.Subscribe(email, frequency); err != nil {
+			status, message := http.StatusInternalServerError, "Failed to sign up, please try again later"
+			if errors.Is(err, newsletter.ErrInvalidEmail) {
+				status, message = http.StatusBadRequest, err.Error()
+			}
+			h.renderNewsletterForm(c, status, gin.H{
+				"email":     email,
+				"frequency": frequency,
+				"error":     message,
+			})
+			return
+		}
+	}
+
+	h.renderNewsletterForm(c, http.StatusOK, gin.H{"submitted": true})
+}
+
+func (h *Handler) ConfirmSubscription(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Query("s"), 10, 64)
+	sub, err := h.Newsletter.Confirm(uint(id), c.Query("token"))
+	if err != nil {
+		h.render(c, http.StatusBadRequest, "newsletter-confirmed.html", gin.H{
+			"error": err.Error(),
+			"title": "Newsletter",
+		})
+		return
+	}
+
+	h.render(c, http.StatusOK, "newsletter-confirmed.html", gin.H{
+		"subscriber": sub,
+		"title":      "Subscription Confirmed",
+	})
+}
+
+// UnsubscribeForm asks before unsubscribing, as mail scanners follow every
+// link in an email
+func (h *Handler) UnsubscribeForm(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Query("s"), 10, 64)
+	sub, err := h.Newsletter.Lookup(uint(id), c.Query("token"))
+	if err != nil {
+		h.render(c, http.StatusBadRequest, "newsletter-unsubscribe.html", gin.H{
+			"error": err.Error(),
+			"title": "Unsubscribe",
+		})
+		return
+	}
+
+	h.render(c, http.StatusOK, "newsletter-unsubscribe.html", gin.H{
+		"subscriber": sub,
+		"token":      c.Query("token"),
+		"title":      "Unsubscribe",
+	})
+}
+
+// Unsubscribe handles both the form and the one-click unsubscribe of mail
+// clients (RFC 8058), which post to the link from the List-Unsubscribe header
+func (h *Handler) Unsubscribe(c *gin.Context) {
+	id, _ := strconv.ParseUint(firstNonEmpty(c.PostForm("s"), c.Query("s")), 10, 64)
+	sub, err := h.Newsletter.Unsubscribe(uint(id), firstNonEmpty(c.PostForm("token"), c.Query("token")))
+	if err != nil {
+		h.render(c, http.StatusBadRequest, "newsletter-unsubscribe.html", gin.H{
+			"error": err.Error(),
+			"title": "Unsubscribe",
+		})
+		return
+	}
+
+	h.render(c, http.StatusOK, "newsletter-unsubscribe.html", gin.H{
+		"subscriber":   sub,
+		"unsubscribed": true,
+		"title":        "Unsubscribed",
+	})
+}
+
+// Admin subscribers
+
+func (h *Handler) AdminSubscribers(c *gin.Context) {
+	query := h.DB.Order("created_at DESC")
+	status := c.Query("status")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var subscribers []models.Subscriber
+	if err := query.Find(&subscribers).Error; err != nil {
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load subscribers",
+		})
+		return
+	}
+
+	counts := make(map[string]int64, len(subscriberStatuses))
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	h.DB.Model(&models.Subscriber{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows)
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	// the outcome of the most recent email to each subscriber
+	var latest []models.EmailDelivery
+	h.DB.Where("id IN (?)", h.DB.Model(&models.EmailDelivery{}).Select("MAX(id)").Group("subscriber_id")).Find(&latest)
+	lastEmail := make(map[uint]models.EmailDelivery, len(latest))
+	for _, email := range latest {
+		lastEmail[email.SubscriberID] = email
+	}
+
+	h.render(c, http.StatusOK, "admin/subscribers.html", gin.H{
+		"subscribers": subscribers,
+		"lastEmail":   lastEmail,
+		"status":      status,
+		"statuses":    subscriberStatuses,
+		"counts":      counts,
+		"title":       "Newsletter Subscribers",
+	})
+}
+
+func (h *Handler) SubscriberEmails(c *gin.Context) {
+	var sub models.Subscriber
+	if err := h.DB.First(&sub, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscriber Not Found"})
+		return
+	}
+
+	var emails []models.EmailDelivery
+	h.DB.Where("subscriber_id = ?", sub.ID).Order("created_at DESC").Limit(100).Find(&emails)
+
+	h.render(c, http.StatusOK, "admin/subscriber-emails.html", gin.H{
+		"subscriber": sub,
+		"emails":     emails,
+		"title":      "Emails to " + sub.Email,
+	})
+}
+
+func (h *Handler) DeleteSubscriber(c *gin.Context) {
+	var sub models.Subscriber
+	if err := h.DB.First(&sub, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscriber Not Found"})
+		return
+	}
+
+	h.DB.Where("subscriber_id = ?", sub.ID).Delete(&models.EmailDelivery{})
+	if err := h.DB.Delete(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete subscriber"})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "subscriberDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/subscribers")
+}
+
+func (h *Handler) RetryEmail(c *gin.Context) {
+	var email models.EmailDelivery
+	if err := h.DB.First(&email, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email Not Found"})
+		return
+	}
+
+	if err := h.Newsletter.Retry(email.ID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	h.DB.First(&email, email.ID)
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "emailRetried")
+		h.render(c, http.StatusOK, "admin/email-row.html", gin.H{"email": email})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/subscribers/"+strconv.FormatUint(uint64(email.SubscriberID), 10)+"/emails")
+}
+
+// Newsletter helpers
+
+// renderNewsletterForm renders just the form for HTMX and the whole page
+// otherwise
+func (h *Handler) renderNewsletterForm(c *gin.Context, status int, data gin.H) {
+	data["frequencies"] = newsletterFrequencies
+	if c.GetHeader("HX-Request") == "true" {
+		h.render(c, status, "newsletter-form.html", data)
+		return
+	}
+	data["title"] = "Newsletter"
+	h.render(c, status, "newsletter.html", data)
+}
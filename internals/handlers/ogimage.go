@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/ogimage"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PostOGImage serves the generated social card of a post. Cards are rendered
+// on first request and kept in storage until the post changes.
+func (h *Handler) PostOGImage(c *gin.Context) {
+	var post models.Post
+	err := h.DB.Where("slug = ? AND published = ?", c.Param("slug"), true).
+		Preload("Tags").
+		First(&post).Error
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	etag := fmt.Sprintf(`"og-%d-%d"`, post.ID, post.UpdatedAt.UnixNano())
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=86400")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, err := h.socialCard(c.Request.Context(), post)
+	if err != nil {
+		log.Printf("Failed to render social card for post %d: %v", post.ID, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Data(http.StatusOK, "image/png", data)
+}
+
+// Social card helpers
+
+func socialCardKey(post models.Post) string {
+	return fmt.Sprintf("og/%d-%d.png", post.ID, post.UpdatedAt.UnixNano())
+}
+
+// socialCard returns the cached card of the post, rendering and storing it
+// when the post changed since it was last drawn. The key of the card is kept
+// on the post so the outdated one can be removed.
+func (h *Handler) socialCard(ctx context.Context, post models.Post) ([]byte, error) {
+	key := socialCardKey(post)
+
+	if r, err := h.Storage.Get(ctx, key); err == nil {
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	site := h.Settings.Get()
+	tags := make([]string, 0, len(post.Tags))
+	for _, tag := range post.Tags {
+		tags = append(tags, tag.Name)
+	}
+
+	data, err := ogimage.Render(ogimage.Card{
+		Title:    post.Title,
+		Tags:     tags,
+		SiteName: site.Title,
+		Date:     site.Local(post.CreatedAt),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.Storage.Put(ctx, key, data, "image/png"); err != nil {
+		return nil, err
+	}
+
+	// UpdateColumn leaves updated_at, which the key is derived from, alone
+	previous := post.SocialCardKey
+	if err := h.DB.Model(&post).UpdateColumn("social_card_key", key).Error; err != nil {
+		log.Printf("Failed to record social card of post %d: %v", post.ID, err)
+	} else if previous != "" && previous != key {
+		if err := h.Storage.Delete(ctx, previous); err != nil {
+			log.Printf("Failed to remove outdated social card %s: %v", previous, err)
+		}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// reservedPageSlugs are first path segments already taken by other routes
+var reservedPageSlugs = map[string]bool{
+	"admin":      true,
+	"ap":         true,
+	"api":        true,
+	"authors":    true,
+	"categories": true,
+	"contact":    true,
+	"feed":       true,
+	"login":      true,
+	"logout":     true,
+	"media":      true,
+	"micropub":   true,
+	"newsletter": true,
+	"posts":      true,
+	"pow":        true,
+	"rss":        true,
+	"series":     true,
+	"sitemaps":   true,
+	"static":     true,
+	"tags":       true,
+	"uploads":    true,
+	"webmention": true,
+}
+
+// Public pages
+
+func (h *Handler) GetPage(c *gin.Context) {
+	var page models.Page
+
+	result := h.DB.Where("slug = ? AND published = ?", c.Param("slug"), true).First(&page)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			h.render(c, http.StatusNotFound, "404.html", gin.H{
+				"message": "Page Not Found",
+			})
+			return
+		}
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load page",
+		})
+		return
+	}
+
+	h.render(c, http.StatusOK, "page.html", gin.H{
+		"page":  page,
+		"title": page.Title,
+	})
+}
+
+// Admin page management
+
+func (h *Handler) AdminPages(c *gin.Context) {
+	var pages []models.Page
+	h.DB.Order("nav_order ASC, title ASC").Find(&pages)
+
+	h.render(c, http.StatusOK, "admin/pages.html", gin.H{
+		"pages": pages,
+		"title": "Manage Pages",
+	})
+}
+
+func (h *Handler) NewPageForm(c *gin.Context) {
+	h.render(c, http.StatusOK, "admin/page-form.html", gin.H{
+		"page":   models.Page{},
+		"title":  "New Page",
+		"action": "/admin/pages",
+		"method": "Post",
+	})
+}
+
+func (h *Handler) CreatePage(c *gin.Context) {
+	var page models.Page
+
+	if err := c.ShouldBind(&page); err != nil {
+		h.render(c, http.StatusBadRequest, "admin/page-form.html", gin.H{
+			"page":  page,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := h.assignPageSlug(&page); err != nil {
+		h.render(c, http.StatusBadRequest, "admin/page-form.html", gin.H{
+			"page":  page,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if page.NavOrder == 0 {
+		var last int
+		h.DB.Model(&models.Page{}).Select("COALESCE(MAX(nav_order), 0)").Scan(&last)
+		page.NavOrder = last + 1
+	}
+
+	if err := h.DB.Create(&page).Error; err != nil {
+		h.render(c, http.StatusInternalServerError, "admin/page-form.html", gin.H{
+			"page":  page,
+			"error": "Failed to create page",
+		})
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "pageCreated")
+		h.render(c, http.StatusOK, "admin/page-row.html", gin.H{"page": page})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/pages")
+}
+
+func (h *Handler) EditPageForm(c *gin.Context) {
+	var page models.Page
+	if err := h.DB.First(&page, c.Param("id")).Error; err != nil {
+		h.render(c, http.StatusNotFound, "404.html", gin.H{
+			"message": "Page not found",
+		})
+		return
+	}
+
+	h.render(c, http.StatusOK, "admin/page-form.html", gin.H{
+		"page":   page,
+		"title":  "Edit Page",
+		"action": fmt.Sprintf("/admin/pages/%d", page.ID),
+		"method": "PATCH",
+	})
+}
+
+func (h *Handler) UpdatePage(c *gin.Context) {
+	var page models.Page
+	if err := h.DB.First(&page, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page Not Found"})
+		return
+	}
+
+	if err := c.ShouldBind(&page); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.assignPageSlug(&page); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&page).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "pageUpdated")
+		h.render(c, http.StatusOK, "admin/page-row.html", gin.H{"page": page})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/pages")
+}
+
+func (h *Handler) DeletePage(c *gin.Context) {
+	var page models.Page
+	if err := h.DB.First(&page, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := h.DB.Delete(&page).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "pageDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/pages")
+}
+
+// ReorderPages stores the navigation order submitted by the sortable admin list
+func (h *Handler) ReorderPages(c *gin.Context) {
+	ids := c.PostFormArray("pages")
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			if err := tx.Model(&models.Page{}).Where("id = ?", id).Update("nav_order", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.invalidateNav()
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "pagesReordered")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/pages")
+}
+
+// Page helpers
+
+// navigationPages returns the published pages flagged for the site navigation
+func (h *Handler) navigationPages() []models.Page {
+	var pages []models.Page
+	h.DB.Where("published = ? AND show_in_nav = ?", true, true).
+		Order("nav_order ASC, title ASC").
+		Find(&pages)
+	return pages
+}
+
+func (h *Handler) assignPageSlug(page *models.Page) error {
+	if page.Slug == "" {
+		page.Slug = page.Title
+	}
+	page.Slug = generateSlug(page.Slug)
+
+	if page.Slug == "" {
+		return fmt.Errorf("a title or slug is required")
+	}
+	if reservedPageSlugs[page.Slug] {
+		return fmt.Errorf("the slug %q is reserved", page.Slug)
+	}
+
+	var existing models.Page
+	if err := h.DB.Where("slug = ? AND id <> ?", page.Slug, page.ID).First(&existing).Error; err == nil {
+		return fmt.Errorf("another page already uses the slug %q", page.Slug)
+	}
+
+	return nil
+}
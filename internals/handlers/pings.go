@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IndexNowKey serves the key file IndexNow fetches to verify our submissions
+func (h *Handler) IndexNowKey(c *gin.Context) {
+	key := h.Settings.Get().IndexNowKey
+	if key == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.String(http.StatusOK, key)
+}
+
+// Admin ping log
+
+func (h *Handler) AdminPings(c *gin.Context) {
+	var pings []models.PingLog
+	query := h.DB.Order("created_at DESC").Limit(100)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Find(&pings)
+
+	h.render(c, http.StatusOK, "admin/pings.html", gin.H{
+		"pings":  pings,
+		"status": c.Query("status"),
+		"title":  "Publication Pings",
+	})
+}
+
+func (h *Handler) RetryPing(c *gin.Context) {
+	var ping models.PingLog
+	if err := h.DB.First(&ping, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ping Not Found"})
+		return
+	}
+
+	if err := h.Notifier.Retry(ping.ID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	h.DB.First(&ping, ping.ID)
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "pingRetried")
+		h.render(c, http.StatusOK, "admin/ping-row.html", gin.H{"ping": ping})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/pings")
+}
+
+// Ping helpers
+
+// notifyChanged announces an edit of a post: one the edit published is
+// announced as new, one that was already out as updated, and one taken down
+// as deleted. Webhooks hear about publishing and unpublishing.
+func (h *Handler) notifyChanged(post models.Post, wasPublished bool) {
+	switch {
+	case post.Published && !wasPublished:
+		h.postEvent(models.EventPostPublished, post)
+		h.notifyPublished(post)
+	case post.Published:
+		h.federate(activityUpdate, post)
+	case wasPublished:
+		h.postEvent(models.EventPostUnpublished, post)
+		h.federate(activityDelete, post)
+	}
+}
+
+// notifyPublished records when the post was first published, tells the
+// WebSub hub about every feed the post now appears in, submits the post to
+// IndexNow, delivers it to fediverse followers and sends webmentions to the
+// pages it links to and emails it to newsletter subscribers. Delivery happens
+// in the background.
+func (h *Handler) notifyPublished(post models.Post) {
+	if !post.Published {
+		return
+	}
+	site := h.Settings.Get()
+
+	if post.PublishedAt == nil {
+		// UpdateColumn keeps updated_at, publishing is not an edit
+		err := h.DB.Model(&models.Post{}).Where("id = ? AND published_at IS NULL", post.ID).
+			UpdateColumn("published_at", time.Now()).Error
+		if err != nil {
+			log.Printf("Failed to record when post %d was published: %v", post.ID, err)
+		}
+	}
+
+	pages := []string{site.URL("/posts/" + post.Slug), site.URL("/")}
+
+	feeds := append(feedTopics(site.URL("/feed")), site.URL("/rss"))
+	if post.AuthorID != nil {
+		feeds = append(feeds, feedTopics(site.URL(fmt.Sprintf("/authors/%d/feed", *post.AuthorID)))...)
+	}
+
+	var tags []models.Tag
+	h.DB.Model(&post).Association("Tags").Find(&tags)
+	for _, tag := range tags {
+		path := "/tags/" + url.PathEscape(tag.Name)
+		pages = append(pages, site.URL(path))
+		feeds = append(feeds, feedTopics(site.URL(path+"/feed"))...)
+	}
+
+	// category feeds include posts from every category below them
+	if post.CategoryID != nil {
+		var category models.Category
+		if err := h.DB.First(&category, *post.CategoryID).Error; err == nil {
+			for _, crumb := range h.categoryBreadcrumbs(&category) {
+				path := "/categories/" + crumb.Slug
+				pages = append(pages, site.URL(path))
+				feeds = append(feeds, feedTopics(site.URL(path+"/rss"))...)
+			}
+		}
+	}
+
+	if err := h.Notifier.Published(pages, feeds); err != nil {
+		log.Printf("Failed to queue publication pings for post %d: %v", post.ID, err)
+	}
+
+	h.federate(activityCreate, post)
+
+	if site.SendWebmentions {
+		if err := h.Notifier.Mention(site.URL("/posts/"+post.Slug), h.outboundLinks(post)); err != nil {
+			log.Printf("Failed to queue webmentions for post %d: %v", post.ID, err)
+		}
+	}
+
+	if err := h.Newsletter.Published(post); err != nil {
+		log.Printf("Failed to queue newsletter emails for post %d: %v", post.ID, err)
+	}
+}
+
+// feedTopics are the addresses a feed can be subscribed at: without a format
+// and with each format spelled out, since WebSub matches topics exactly
+func feedTopics(feedURL string) []string {
+	topics := []string{feedURL}
+	for _, format := range []string{"atom", "json", "rss"} {
+		topics = append(topics, feedURL+"?format="+format)
+	}
+	return topics
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/pow"
+	"RustyBits/internals/spam"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PowChallenge hands out a fresh proof of work challenge for a form
+func (h *Handler) PowChallenge(c *gin.Context) {
+	challenge, err := h.PoW.Issue()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue challenge"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, challenge)
+}
+
+// PowScript serves the script that solves challenges in the browser
+func (h *Handler) PowScript(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "text/javascript; charset=utf-8", pow.Script)
+}
+
+// Forms turned away by the proof of work check are shown again with what was
+// typed into them, as a validation error would be
+
+func (h *Handler) RejectComment(c *gin.Context, err error) {
+	var post models.Post
+	if err := h.DB.Where("slug = ? AND published = ?", c.Param("slug"), true).First(&post).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post Not Found"})
+		return
+	}
+
+	h.render(c, http.StatusForbidden, "comment-form.html", gin.H{
+		"post": post,
+		"comment": models.Comment{
+			PostID:   post.ID,
+			ParentID: parseOptionalID(c.PostForm("parent_id")),
+			Name:     strings.TrimSpace(c.PostForm("name")),
+			Email:    strings.TrimSpace(c.PostForm("email")),
+			Website:  strings.TrimSpace(c.PostForm("website")),
+			Content:  strings.TrimSpace(c.PostForm("content")),
+		},
+		"formStamp": c.PostForm(spam.StampField),
+		"error":     err.Error(),
+	})
+}
+
+func (h *Handler) RejectContact(c *gin.Context, err error) {
+	h.renderContactForm(c, http.StatusForbidden, gin.H{
+		"message": models.ContactMessage{
+			Name:    strings.TrimSpace(c.PostForm("name")),
+			Email:   strings.TrimSpace(c.PostForm("email")),
+			Subject: strings.TrimSpace(c.PostForm("subject")),
+			Body:    strings.TrimSpace(c.PostForm("body")),
+		},
+		"formStamp": c.PostForm(spam.StampField),
+		"error":     err.Error(),
+	})
+}
+
+func (h *Handler) RejectSubscribe(c *gin.Context, err error) {
+	h.renderNewsletterForm(c, http.StatusForbidden, gin.H{
+		"email":     c.PostForm("email"),
+		"frequency": c.DefaultPostForm("frequency", models.FrequencyEachPost),
+		"error":     err.Error(),
+	})
+}
+
+func (h *Handler) RejectLogin(c *gin.Context, err error) {
+	h.render(c, http.StatusForbidden, "login.html", gin.H{
+		"email": c.PostForm("email"),
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"net/url"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MenuLink is a menu item resolved to the url it currently points at
+type MenuLink struct {
+	Label    string
+	URL      string
+	External bool
+	Children []MenuLink
+}
+
+// navCache keeps the resolved menus and navigation pages between requests. It
+// is dropped whenever menus or anything a menu can point at changes.
+type navCache struct {
+	mu     sync.RWMutex
+	loaded bool
+	menus  map[string][]MenuLink
+	pages  []models.Page
+}
+
+// render is c.HTML with the site wide template context merged in. Values set
+// by the handler win over the shared ones.
+func (h *Handler) render(c *gin.Context, code int, name string, data gin.H) {
+	if data == nil {
+		data = gin.H{}
+	}
+	for key, value := range h.siteContext(c) {
+		if _, ok := data[key]; !ok {
+			data[key] = value
+		}
+	}
+	c.HTML(code, name, data)
+}
+
+// siteContext is the data every template can rely on
+func (h *Handler) siteContext(c *gin.Context) gin.H {
+	menus, pages := h.navigation()
+	site := h.Settings.Get()
+
+	ctx := gin.H{
+		"site":     site,
+		"menus":    menus,
+		"navPages": pages,
+		"feeds":    siteFeedLinks(site.Title),
+	}
+	if user, ok := c.Get("user"); ok {
+		ctx["currentUser"] = user
+	}
+	return ctx
+}
+
+func (h *Handler) navigation() (map[string][]MenuLink, []models.Page) {
+	h.nav.mu.RLock()
+	if h.nav.loaded {
+		defer h.nav.mu.RUnlock()
+		return h.nav.menus, h.nav.pages
+	}
+	h.nav.mu.RUnlock()
+
+	h.nav.mu.Lock()
+	defer h.nav.mu.Unlock()
+	if !h.nav.loaded {
+		h.nav.menus = h.loadMenus()
+		h.nav.pages = h.navigationPages()
+		h.nav.loaded = true
+	}
+	return h.nav.menus, h.nav.pages
+}
+
+func (h *Handler) invalidateNav() {
+	h.nav.mu.Lock()
+	h.nav.loaded = false
+	h.nav.mu.Unlock()
+}
+
+func (h *Handler) loadMenus() map[string][]MenuLink {
+	var menus []models.Menu
+	h.DB.Find(&menus)
+
+	resolved := make(map[string][]MenuLink, len(menus))
+	for _, menu := range menus {
+		var items []models.MenuItem
+		h.DB.Where("menu_id = ?", menu.ID).Order("position ASC, id ASC").Find(&items)
+		resolved[menu.Name] = h.resolveMenuItems(items)
+	}
+	return resolved
+}
+
+// resolveMenuItems turns a flat, ordered item list into links nested under their parents,
+// skipping items whose target is gone or unpublished
+func (h *Handler) resolveMenuItems(items []models.MenuItem) []MenuLink {
+	children := make(map[uint][]models.MenuItem)
+	for _, item := range items {
+		if item.ParentID != nil {
+			children[*item.ParentID] = append(children[*item.ParentID], item)
+		}
+	}
+
+	var links []MenuLink
+	for _, item := range items {
+		if item.ParentID != nil {
+			continue
+		}
+		link, ok := h.resolveMenuItem(item)
+		if !ok {
+			continue
+		}
+		for _, child := range children[item.ID] {
+			if childLink, ok := h.resolveMenuItem(child); ok {
+				link.Children = append(link.Children, childLink)
+			}
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+func (h *Handler) resolveMenuItem(item models.MenuItem) (MenuLink, bool) {
+	link := MenuLink{Label: item.Label}
+
+	switch item.Kind {
+	case models.MenuItemPage:
+		var page models.Page
+		if item.TargetID == nil || h.DB.Where("published = ?", true).First(&page, *item.TargetID).Error != nil {
+			return link, false
+		}
+		link.URL = "/" + page.Slug
+	case models.MenuItemPost:
+		var post models.Post
+		if item.TargetID == nil || h.DB.Where("published = ?", true).First(&post, *item.TargetID).Error != nil {
+			return link, false
+		}
+		link.URL = "/posts/" + post.Slug
+	case models.MenuItemTag:
+		var tag models.Tag
+		if item.TargetID == nil || h.DB.First(&tag, *item.TargetID).Error != nil {
+			return link, false
+		}
+		link.URL = "/tags/" + url.PathEscape(tag.Name)
+	case models.MenuItemURL:
+		// items saved before urls were checked may hold any scheme
+		if !isWebURL(item.URL) && !isSitePath(item.URL) {
+			return link, false
+		}
+		link.URL = item.URL
+		link.External = isWebURL(item.URL)
+	default:
+		return link, false
+	}
+
+	return link, true
+}
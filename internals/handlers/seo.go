@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"RustyBits/internals/media"
+	"RustyBits/internals/models"
+	"RustyBits/internals/ogimage"
+	"RustyBits/internals/settings"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metaDescriptionLength is where descriptions derived from content are cut off
+const metaDescriptionLength = 160
+
+// PageMeta is what post.html puts in <head> for search engines and social
+// previews. Every field is already resolved, fallbacks included.
+type PageMeta struct {
+	Title       string
+	Description string
+	Canonical   string
+	Type        string
+
+	Image       string
+	ImageWidth  int
+	ImageHeight int
+	ImageAlt    string
+
+	TwitterCard string
+	TwitterSite string
+
+	Author string
+
+	Published time.Time
+	Modified  time.Time
+	Section   string
+	Tags      []string
+
+	// JSONLD is the BlogPosting structured data, safe to drop into a script tag
+	JSONLD template.JS
+}
+
+// postMeta resolves the metadata of a post: the post's own overrides first,
+// then what can be derived from the post, then the site settings
+func (h *Handler) postMeta(post models.Post) PageMeta {
+	site := h.Settings.Get()
+
+	meta := PageMeta{
+		Title:       firstNonEmpty(post.SEOTitle, post.Title),
+		Description: firstNonEmpty(post.MetaDescription, post.Excerpt, plainText(post.Content, metaDescriptionLength), site.Tagline),
+		Canonical:   firstNonEmpty(post.CanonicalURL, site.URL("/posts/"+post.Slug)),
+		Type:        "article",
+		TwitterCard: "summary",
+		TwitterSite: site.TwitterSite,
+		Author:      h.authorName(post),
+		Published:   post.CreatedAt,
+		Modified:    post.UpdatedAt,
+	}
+
+	if post.FeaturedImage != nil && !post.FeaturedImage.Private {
+		meta.Image = absoluteURL(site, h.Storage.URL(post.FeaturedImage.Path))
+		meta.ImageWidth = post.FeaturedImage.Width
+		meta.ImageHeight = post.FeaturedImage.Height
+		meta.ImageAlt = post.FeaturedImage.AltText
+	} else if site.SocialCards {
+		meta.Image = site.URL("/posts/" + post.Slug + "/og.png")
+		meta.ImageWidth = ogimage.Width
+		meta.ImageHeight = ogimage.Height
+		meta.ImageAlt = meta.Title
+	} else if site.SocialImage != "" {
+		meta.Image = absoluteURL(site, site.SocialImage)
+	}
+	if meta.Image != "" {
+		meta.TwitterCard = "summary_large_image"
+	}
+
+	if post.Category != nil {
+		meta.Section = post.Category.Name
+	}
+	for _, tag := range post.Tags {
+		meta.Tags = append(meta.Tags, tag.Name)
+	}
+
+	meta.JSONLD = blogPosting(site, meta)
+	return meta
+}
+
+// blogPosting renders the schema.org BlogPosting for a post
+func blogPosting(site settings.Site, meta PageMeta) template.JS {
+	data := gin.H{
+		"@context":         "https://schema.org",
+		"@type":            "BlogPosting",
+		"headline":         meta.Title,
+		"description":      meta.Description,
+		"url":              meta.Canonical,
+		"mainEntityOfPage": gin.H{"@type": "WebPage", "@id": meta.Canonical},
+		"datePublished":    meta.Published.Format(time.RFC3339),
+		"dateModified":     meta.Modified.Format(time.RFC3339),
+		"author":           gin.H{"@type": "Person", "name": meta.Author},
+		"publisher":        gin.H{"@type": "Organization", "name": site.Title, "url": site.URL("/")},
+	}
+	if meta.Image != "" {
+		data["image"] = meta.Image
+	}
+	if meta.Section != "" {
+		data["articleSection"] = meta.Section
+	}
+	if len(meta.Tags) > 0 {
+		data["keywords"] = strings.Join(meta.Tags, ", ")
+	}
+
+	// json.Marshal escapes <, > and &, so the result can not close the script tag
+	out, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	return template.JS(out)
+}
+
+// applySEOForm reads the featured image and metadata overrides of the post form
+func (h *Handler) applySEOForm(c *gin.Context, post *models.Post) error {
+	post.SEOTitle = strings.TrimSpace(post.SEOTitle)
+	post.MetaDescription = strings.TrimSpace(post.MetaDescription)
+	post.CanonicalURL = strings.TrimSpace(post.CanonicalURL)
+	post.FeaturedImage = nil
+	post.FeaturedImageID = parseOptionalID(c.PostForm("featured_image_id"))
+
+	if post.CanonicalURL != "" {
+		u, err := url.Parse(post.CanonicalURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("canonical url must be an absolute http(s) url")
+		}
+	}
+
+	if post.FeaturedImageID != nil {
+		var item models.Media
+		if err := h.DB.First(&item, *post.FeaturedImageID).Error; err != nil {
+			return fmt.Errorf("featured image %d does not exist", *post.FeaturedImageID)
+		}
+		if !media.IsImage(item.MimeType) || item.Private {
+			return errors.New("featured image must be a public image")
+		}
+	}
+
+	return nil
+}
+
+// SEO helpers
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// absoluteURL resolves urls relative to the site, such as local uploads, against the base url
+func absoluteURL(site settings.Site, raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.IsAbs() {
+		return raw
+	}
+	return site.URL(raw)
+}
+
+var (
+	tagPattern   = regexp.MustCompile(`<[^>]*>`)
+	spacePattern = regexp.MustCompile(`\s+`)
+)
+
+// plainText strips the markup from content and cuts it at a word boundary
+// to at most limit characters
+func plainText(content string, limit int) string {
+	text := html.UnescapeString(tagPattern.ReplaceAllString(content, " "))
+	text = strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	cut := string(runes[:limit])
+	if i := strings.LastIndex(cut, " "); i > limit/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
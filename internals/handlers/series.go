@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SeriesNav is the "Part N of M" block shown on posts that belong to a series
+type SeriesNav struct {
+	Series models.Series
+	Part   int
+	Total  int
+	Prev   *models.Post
+	Next   *models.Post
+	Parts  []models.Post
+}
+
+// Public series pages
+
+func (h *Handler) GetSeriesList(c *gin.Context) {
+	var series []models.Series
+
+	result := h.DB.Preload("Posts", publishedSeriesPosts).
+		Order("title ASC").
+		Find(&series)
+
+	if result.Error != nil {
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "failed to load series",
+		})
+		return
+	}
+
+	h.render(c, http.StatusOK, "series-list.html", gin.H{
+		"series": series,
+		"title":  "Series",
+	})
+}
+
+func (h *Handler) GetSeries(c *gin.Context) {
+	var series models.Series
+
+	result := h.DB.Where("slug = ?", c.Param("slug")).
+		Preload("Posts", publishedSeriesPosts).
+		Preload("Posts.Tags").
+		First(&series)
+
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			h.render(c, http.StatusNotFound, "404.html", gin.H{
+				"message": "Series Not Found",
+			})
+			return
+		}
+		h.render(c, http.StatusInternalServerError, "error.html", gin.H{
+			"error": "Failed to load series",
+		})
+		return
+	}
+
+	h.render(c, http.StatusOK, "series.html", gin.H{
+		"series": series,
+		"posts":  series.Posts,
+		"title":  series.Title,
+	})
+}
+
+// Admin series management
+
+func (h *Handler) AdminSeries(c *gin.Context) {
+	var series []models.Series
+	h.DB.Preload("Posts", func(db *gorm.DB) *gorm.DB {
+		return db.Order("series_order ASC, created_at ASC")
+	}).Order("title ASC").Find(&series)
+
+	h.render(c, http.StatusOK, "admin/series.html", gin.H{
+		"series": series,
+		"title":  "Manage Series",
+	})
+}
+
+func (h *Handler) CreateSeries(c *gin.Context) {
+	series := models.Series{
+		Title:       c.PostForm("title"),
+		Description: c.PostForm("description"),
+	}
+
+	if series.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+		return
+	}
+
+	series.Slug = h.uniqueSeriesSlug(series.Title, 0)
+
+	if err := h.DB.Create(&series).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create series"})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "seriesCreated")
+		h.render(c, http.StatusOK, "admin/series-row.html", gin.H{"series": series})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/series")
+}
+
+func (h *Handler) UpdateSeries(c *gin.Context) {
+	var series models.Series
+	if err := h.DB.First(&series, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Series Not Found"})
+		return
+	}
+
+	if title := c.PostForm("title"); title != "" {
+		series.Title = title
+		series.Slug = h.uniqueSeriesSlug(title, series.ID)
+	}
+	if description, ok := c.GetPostForm("description"); ok {
+		series.Description = description
+	}
+
+	if err := h.DB.Save(&series).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the admin list submits the post ids in their new order when parts are reordered
+	if order := c.PostFormArray("posts"); len(order) > 0 {
+		if err := h.reorderSeries(series.ID, order); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "seriesUpdated")
+		h.render(c, http.StatusOK, "admin/series-row.html", gin.H{"series": series})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/series")
+}
+
+func (h *Handler) DeleteSeries(c *gin.Context) {
+	var series models.Series
+	if err := h.DB.First(&series, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	// posts stay, they just stop being parts of the series
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Post{}).
+			Where("series_id = ?", series.ID).
+			Updates(map[string]any{"series_id": nil, "series_order": 0}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&series).Error
+	})
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "seriesDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/series")
+}
+
+// Series helpers
+
+func publishedSeriesPosts(db *gorm.DB) *gorm.DB {
+	return db.Where("published = ?", true).Order("series_order ASC, created_at ASC")
+}
+
+// seriesNavigation builds the part counter and neighbours for a published post in a series
+func (h *Handler) seriesNavigation(post models.Post) *SeriesNav {
+	if post.SeriesID == nil {
+		return nil
+	}
+
+	var series models.Series
+	if err := h.DB.Preload("Posts", publishedSeriesPosts).First(&series, *post.SeriesID).Error; err != nil {
+		return nil
+	}
+
+	nav := &SeriesNav{Series: series, Total: len(series.Posts), Parts: series.Posts}
+	for i := range series.Posts {
+		if series.Posts[i].ID != post.ID {
+			continue
+		}
+		nav.Part = i + 1
+		if i > 0 {
+			nav.Prev = &series.Posts[i-1]
+		}
+		if i < len(series.Posts)-1 {
+			nav.Next = &series.Posts[i+1]
+		}
+		break
+	}
+	if nav.Part == 0 {
+		return nil
+	}
+
+	return nav
+}
+
+// applySeriesForm reads series_id and series_order from the post form, appending
+// the post to the end of the series when no explicit position is given. A form
+// without series_id leaves the post's series alone.
+func (h *Handler) applySeriesForm(c *gin.Context, post *models.Post) {
+	value, ok := c.GetPostForm("series_id")
+	if !ok {
+		return
+	}
+	seriesID := parseOptionalID(value)
+	order, _ := strconv.Atoi(c.PostForm("series_order"))
+
+	changed := seriesID == nil || post.SeriesID == nil || *seriesID != *post.SeriesID
+	post.SeriesID = seriesID
+	post.Series = nil
+
+	if seriesID == nil {
+		post.SeriesOrder = 0
+		return
+	}
+
+	if order > 0 {
+		post.SeriesOrder = order
+		return
+	}
+
+	if changed || post.SeriesOrder == 0 {
+		var last int
+		h.DB.Model(&models.Post{}).
+			Where("series_id = ? AND id <> ?", *seriesID, post.ID).
+			Select("COALESCE(MAX(series_order), 0)").
+			Scan(&last)
+		post.SeriesOrder = last + 1
+	}
+}
+
+// uniqueSeriesSlug slugs title, numbering it when another series has the slug
+func (h *Handler) uniqueSeriesSlug(title string, selfID uint) string {
+	slug := generateSlug(title)
+	if slug == "" {
+		// titles without any ASCII letters or digits slug to nothing
+		slug = "series"
+	}
+	taken := func(candidate string) bool {
+		var count int64
+		h.DB.Model(&models.Series{}).Where("slug = ? AND id <> ?", candidate, selfID).Count(&count)
+		return count > 0
+	}
+
+	if !taken(slug) {
+		return slug
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", slug, i)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+func (h *Handler) reorderSeries(seriesID uint, postIDs []string) error {
+	return h.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range postIDs {
+			if err := tx.Model(&models.Post{}).
+				Where("id = ? AND series_id = ?", id, seriesID).
+				Update("series_order", i+1).Error; err != nil {
+				return fmt.Errorf("reorder post %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"RustyBits/internals/settings"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) AdminSettings(c *gin.Context) {
+	h.render(c, http.StatusOK, "admin/settings.html", gin.H{
+		"settings":  h.Settings.Get(),
+		"timezones": commonTimezones,
+		"title":     "Settings",
+	})
+}
+
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	// checkboxes are sent after a hidden "false" input, so the last value wins
+	site, err := settings.FromForm(h.Settings.Get(), func(key string) (string, bool) {
+		values, ok := c.GetPostFormArray(key)
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return values[len(values)-1], true
+	})
+	if err == nil {
+		err = h.Settings.Update(site)
+	}
+
+	if err != nil {
+		h.render(c, http.StatusBadRequest, "admin/settings.html", gin.H{
+			"settings":  site,
+			"timezones": commonTimezones,
+			"title":     "Settings",
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "settingsUpdated")
+		h.render(c, http.StatusOK, "admin/settings.html", gin.H{
+			"settings":  site,
+			"timezones": commonTimezones,
+			"title":     "Settings",
+			"saved":     time.Now(),
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/settings")
+}
+
+var commonTimezones = []string{
+	"UTC",
+	"Europe/London",
+	"Europe/Berlin",
+	"Europe/Istanbul",
+	"Asia/Tehran",
+	"Asia/Dubai",
+	"Asia/Kolkata",
+	"Asia/Tokyo",
+	"Australia/Sydney",
+	"America/New_York",
+	"America/Chicago",
+	"America/Los_Angeles",
+}
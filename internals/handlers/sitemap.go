@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sitemapLimit is the most urls the sitemap protocol allows in one file
+const sitemapLimit = 50000
+
+const sitemapXMLNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// sitemapKinds are the sitemaps listed in the index, in order. Archives are
+// the category and series listings.
+var sitemapKinds = []string{"pages", "posts", "tags", "archives"}
+
+type sitemapEntry struct {
+	Path    string
+	LastMod time.Time
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// Sitemap is the sitemap index, pointing at one file per kind and per
+// 50,000 urls
+func (h *Handler) Sitemap(c *gin.Context) {
+	site := h.Settings.Get()
+	index := sitemapIndex{XMLNS: sitemapXMLNS}
+
+	for _, kind := range sitemapKinds {
+		entries, err := h.sitemapEntries(kind)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		for n, chunk := range chunkSitemap(entries) {
+			var newest time.Time
+			for _, entry := range chunk {
+				if entry.LastMod.After(newest) {
+					newest = entry.LastMod
+				}
+			}
+			index.Sitemaps = append(index.Sitemaps, sitemapURL{
+				Loc:     site.URL(fmt.Sprintf("/sitemaps/%s-%d.xml", kind, n+1)),
+				LastMod: sitemapDate(newest),
+			})
+		}
+	}
+
+	writeXML(c, index)
+}
+
+// SitemapFile serves one file of the index, named like posts-1.xml
+func (h *Handler) SitemapFile(c *gin.Context) {
+	name := strings.TrimSuffix(c.Param("name"), ".xml")
+	kind, number, ok := strings.Cut(name, "-")
+	n, err := strconv.Atoi(number)
+	if !ok || err != nil || n < 1 || !isSitemapKind(kind) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	entries, err := h.sitemapEntries(kind)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	chunks := chunkSitemap(entries)
+	if n > len(chunks) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	site := h.Settings.Get()
+	set := sitemapURLSet{XMLNS: sitemapXMLNS}
+	for _, entry := range chunks[n-1] {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     site.URL(entry.Path),
+			LastMod: sitemapDate(entry.LastMod),
+		})
+	}
+
+	writeXML(c, set)
+}
+
+// Robots serves robots.txt: the admin and api stay out of search engines,
+// followed by the rules from the settings and the sitemap location
+func (h *Handler) Robots(c *gin.Context) {
+	site := h.Settings.Get()
+
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	b.WriteString("Disallow: /admin\n")
+	b.WriteString("Disallow: /api\n")
+	if rules := strings.TrimSpace(strings.ReplaceAll(site.RobotsTxt, "\r\n", "\n")); rules != "" {
+		b.WriteString("\n" + rules + "\n")
+	}
+	b.WriteString("\nSitemap: " + site.URL("/sitemap.xml") + "\n")
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.String(http.StatusOK, b.String())
+}
+
+// Sitemap helpers
+
+func isSitemapKind(kind string) bool {
+	for _, k := range sitemapKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// sitemapEntries lists every public url of one kind with the time it last changed
+func (h *Handler) sitemapEntries(kind string) ([]sitemapEntry, error) {
+	var entries []sitemapEntry
+
+	switch kind {
+	case "pages":
+		var newest struct{ UpdatedAt string }
+		h.DB.Model(&models.Post{}).Select("MAX(updated_at) AS updated_at").
+			Where("published = ?", true).Scan(&newest)
+		entries = append(entries, sitemapEntry{Path: "/", LastMod: parseSQLTime(newest.UpdatedAt)})
+
+		var pages []models.Page
+		if err := h.DB.Select("slug, updated_at").Where("published = ?", true).
+			Order("id ASC").Find(&pages).Error; err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			entries = append(entries, sitemapEntry{Path: "/" + page.Slug, LastMod: page.UpdatedAt})
+		}
+
+	case "posts":
+		var posts []models.Post
+		if err := h.DB.Select("slug, updated_at").Where("published = ?", true).
+			Order("id ASC").Find(&posts).Error; err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			entries = append(entries, sitemapEntry{Path: "/posts/" + post.Slug, LastMod: post.UpdatedAt})
+		}
+
+	case "tags":
+		var rows []struct {
+			Name      string
+			UpdatedAt string
+		}
+		err := h.DB.Table("tags").
+			Select("tags.name, MAX(posts.updated_at) AS updated_at").
+			Joins("JOIN post_tags ON post_tags.tag_id = tags.id").
+			Joins("JOIN posts ON posts.id = post_tags.post_id").
+			Where("posts.published = ?", true).
+			Group("tags.id, tags.name").
+			Order("tags.name ASC").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			entries = append(entries, sitemapEntry{Path: "/tags/" + url.PathEscape(row.Name), LastMod: parseSQLTime(row.UpdatedAt)})
+		}
+
+	case "archives":
+		var categories []struct {
+			Slug      string
+			UpdatedAt string
+		}
+		err := h.DB.Table("categories").
+			Select("categories.slug, MAX(posts.updated_at) AS updated_at").
+			Joins("LEFT JOIN posts ON posts.category_id = categories.id AND posts.published = ?", true).
+			Group("categories.id, categories.slug").
+			Order("categories.slug ASC").
+			Scan(&categories).Error
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, sitemapEntry{Path: "/categories"})
+		for _, category := range categories {
+			entries = append(entries, sitemapEntry{Path: "/categories/" + category.Slug, LastMod: parseSQLTime(category.UpdatedAt)})
+		}
+
+		var series []models.Series
+		if err := h.DB.Select("id, slug, updated_at").Order("slug ASC").Find(&series).Error; err != nil {
+			return nil, err
+		}
+		entries = append(entries, sitemapEntry{Path: "/series"})
+		for _, s := range series {
+			var newest struct{ UpdatedAt string }
+			h.DB.Model(&models.Post{}).Select("MAX(updated_at) AS updated_at").
+				Where("series_id = ? AND published = ?", s.ID, true).Scan(&newest)
+
+			lastMod := s.UpdatedAt
+			if t := parseSQLTime(newest.UpdatedAt); t.After(lastMod) {
+				lastMod = t
+			}
+			entries = append(entries, sitemapEntry{Path: "/series/" + s.Slug, LastMod: lastMod})
+		}
+	}
+
+	return entries, nil
+}
+
+// chunkSitemap splits entries into files of at most sitemapLimit urls
+func chunkSitemap(entries []sitemapEntry) [][]sitemapEntry {
+	var chunks [][]sitemapEntry
+	for len(entries) > sitemapLimit {
+		chunks = append(chunks, entries[:sitemapLimit])
+		entries = entries[sitemapLimit:]
+	}
+	if len(entries) > 0 {
+		chunks = append(chunks, entries)
+	}
+	return chunks
+}
+
+func sitemapDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseSQLTime reads an aggregated timestamp, which sqlite hands back as text
+func parseSQLTime(value string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func writeXML(c *gin.Context, v any) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), out...))
+}
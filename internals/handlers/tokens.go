@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"RustyBits/internals/apitoken"
+	"RustyBits/internals/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokens lists the API tokens, for Micropub apps and other clients
+func (h *Handler) AdminTokens(c *gin.Context) {
+	h.render(c, http.StatusOK, "admin/tokens.html", h.tokensData())
+}
+
+// CreateToken issues a token to the current user. The token is only ever
+// shown in this response.
+func (h *Handler) CreateToken(c *gin.Context) {
+	name := strings.TrimSpace(c.PostForm("name"))
+	scope := apitoken.Normalize(c.PostFormArray("scope"))
+
+	data := h.tokensData()
+	if name == "" || scope == "" {
+		data["error"] = "A token needs a name and at least one scope"
+		h.render(c, http.StatusBadRequest, "admin/tokens.html", data)
+		return
+	}
+
+	plain, hash, err := apitoken.Generate()
+	if err != nil {
+		data["error"] = "Failed to generate token"
+		h.render(c, http.StatusInternalServerError, "admin/tokens.html", data)
+		return
+	}
+
+	token := models.APIToken{Name: name, UserID: c.GetUint("user_id"), Hash: hash, Scope: scope}
+	if err := h.DB.Create(&token).Error; err != nil {
+		data["error"] = "Failed to create token"
+		h.render(c, http.StatusInternalServerError, "admin/tokens.html", data)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "tokenCreated")
+		h.render(c, http.StatusOK, "admin/token-created.html", gin.H{"token": token, "secret": plain})
+		return
+	}
+
+	data = h.tokensData()
+	data["created"] = token
+	data["secret"] = plain
+	h.render(c, http.StatusCreated, "admin/tokens.html", data)
+}
+
+func (h *Handler) DeleteToken(c *gin.Context) {
+	var token models.APIToken
+	if err := h.DB.First(&token, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := h.DB.Delete(&token).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "tokenDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/tokens")
+}
+
+// Token helpers
+
+func (h *Handler) tokensData() gin.H {
+	var tokens []models.APIToken
+	h.DB.Preload("User").Order("created_at DESC").Find(&tokens)
+
+	return gin.H{
+		"tokens":           tokens,
+		"scopes":           apitoken.Scopes,
+		"micropubEndpoint": h.Settings.Get().URL("/micropub"),
+		"title":            "API Tokens",
+	}
+}
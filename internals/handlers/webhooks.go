@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/webhook"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookPost is the data of every post event
+type WebhookPost struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Slug      string    `json:"slug"`
+	URL       string    `json:"url"`
+	Excerpt   string    `json:"excerpt"`
+	Published bool      `json:"published"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (h *Handler) AdminWebhooks(c *gin.Context) {
+	h.render(c, http.StatusOK, "admin/webhooks.html", h.webhooksData())
+}
+
+// CreateWebhook adds an endpoint. Without a secret one is generated, which
+// the receiver needs to check the signatures.
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	hook := models.Webhook{
+		URL:    strings.TrimSpace(c.PostForm("url")),
+		Secret: strings.TrimSpace(c.PostForm("secret")),
+		Events: webhookEvents(c.PostFormArray("events")),
+		Active: true,
+	}
+
+	data := h.webhooksData()
+	if !isWebURL(hook.URL) {
+		data["error"] = "A webhook needs an absolute http(s) url"
+		h.render(c, http.StatusBadRequest, "admin/webhooks.html", data)
+		return
+	}
+	if hook.Events == "" {
+		data["error"] = "Choose at least one event to send"
+		h.render(c, http.StatusBadRequest, "admin/webhooks.html", data)
+		return
+	}
+	if hook.Secret == "" {
+		secret, err := webhook.GenerateSecret()
+		if err != nil {
+			data["error"] = "Failed to generate a secret"
+			h.render(c, http.StatusInternalServerError, "admin/webhooks.html", data)
+			return
+		}
+		hook.Secret = secret
+	}
+
+	if err := h.DB.Create(&hook).Error; err != nil {
+		data["error"] = "Failed to create webhook"
+		h.render(c, http.StatusInternalServerError, "admin/webhooks.html", data)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "webhookCreated")
+		h.render(c, http.StatusOK, "admin/webhook-row.html", gin.H{"webhook": hook, "events": models.WebhookEvents})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webhooks")
+}
+
+// UpdateWebhook changes the url, events and active state of a webhook. The
+// secret is only replaced when a new one is given, and the active state only
+// when the form has the field.
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	var hook models.Webhook
+	if err := h.DB.First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook Not Found"})
+		return
+	}
+
+	url := strings.TrimSpace(c.PostForm("url"))
+	if !isWebURL(url) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A webhook needs an absolute http(s) url"})
+		return
+	}
+
+	events := webhookEvents(c.PostFormArray("events"))
+	if events == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose at least one event to send"})
+		return
+	}
+
+	updates := map[string]any{
+		"url":    url,
+		"events": events,
+	}
+	// checkboxes are sent after a hidden "false" input, so the last value wins
+	if values := c.PostFormArray("active"); len(values) > 0 {
+		updates["active"] = values[len(values)-1] == "true"
+	}
+	if secret := strings.TrimSpace(c.PostForm("secret")); secret != "" {
+		updates["secret"] = secret
+	}
+	if err := h.DB.Model(&hook).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+	h.DB.First(&hook, hook.ID)
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "webhookUpdated")
+		h.render(c, http.StatusOK, "admin/webhook-row.html", gin.H{"webhook": hook, "events": models.WebhookEvents})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webhooks")
+}
+
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	var hook models.Webhook
+	if err := h.DB.First(&hook, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	h.DB.Where("webhook_id = ?", hook.ID).Delete(&models.WebhookDelivery{})
+	if err := h.DB.Delete(&hook).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "webhookDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webhooks")
+}
+
+// WebhookDeliveries is the delivery log of one webhook, newest first
+func (h *Handler) WebhookDeliveries(c *gin.Context) {
+	var hook models.Webhook
+	if err := h.DB.First(&hook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook Not Found"})
+		return
+	}
+
+	query := h.DB.Where("webhook_id = ?", hook.ID).Order("created_at DESC").Limit(100)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []models.WebhookDelivery
+	query.Find(&deliveries)
+
+	h.render(c, http.StatusOK, "admin/webhook-deliveries.html", gin.H{
+		"webhook":    hook,
+		"deliveries": deliveries,
+		"status":     c.Query("status"),
+		"title":      "Deliveries to " + hook.URL,
+	})
+}
+
+// RedeliverWebhook sends an earlier delivery's payload again
+func (h *Handler) RedeliverWebhook(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	delivery, err := h.Webhooks.Redeliver(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery Not Found"})
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "webhookRedelivered")
+		h.render(c, http.StatusOK, "admin/webhook-delivery-row.html", gin.H{"delivery": delivery})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webhooks/"+strconv.FormatUint(uint64(delivery.WebhookID), 10)+"/deliveries")
+}
+
+// Webhook helpers
+
+func (h *Handler) webhooksData() gin.H {
+	var hooks []models.Webhook
+	h.DB.Order("created_at ASC").Find(&hooks)
+
+	var deliveries []models.WebhookDelivery
+	h.DB.Order("created_at DESC").Limit(50).Find(&deliveries)
+
+	return gin.H{
+		"webhooks":   hooks,
+		"deliveries": deliveries,
+		"events":     models.WebhookEvents,
+		"title":      "Webhooks",
+	}
+}
+
+// webhookEvents keeps the known events from a form, empty when none was
+// chosen
+func webhookEvents(values []string) string {
+	var events []string
+	for _, event := range models.WebhookEvents {
+		for _, v := range values {
+			if v == event {
+				events = append(events, event)
+				break
+			}
+		}
+	}
+	return strings.Join(events, ",")
+}
+
+func (h *Handler) webhookPost(post models.Post) WebhookPost {
+	tags := post.Tags
+	if tags == nil {
+		h.DB.Model(&post).Association("Tags").Find(&tags)
+	}
+
+	data := WebhookPost{
+		ID:        post.ID,
+		Title:     post.Title,
+		Slug:      post.Slug,
+		URL:       h.Settings.Get().URL("/posts/" + post.Slug),
+		Excerpt:   post.Excerpt,
+		Published: post.Published,
+		Tags:      []string{},
+		CreatedAt: post.CreatedAt,
+		UpdatedAt: post.UpdatedAt,
+	}
+	for _, tag := range tags {
+		data.Tags = append(data.Tags, tag.Name)
+	}
+	return data
+}
+
+// postEvent fires a post event at the webhooks subscribed to it
+func (h *Handler) postEvent(event string, post models.Post) {
+	h.fireWebhooks(event, h.webhookPost(post))
+}
+
+func (h *Handler) fireWebhooks(event string, data any) {
+	if err := h.Webhooks.Fire(event, data); err != nil {
+		log.Printf("Failed to queue %s webhooks: %v", event, err)
+	}
+}
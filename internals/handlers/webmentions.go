@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/webmention"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// ReceiveWebmention accepts a webmention for one of our posts. The source is
+// verified in the background, as the spec recommends.
+func (h *Handler) ReceiveWebmention(c *gin.Context) {
+	source := strings.TrimSpace(c.PostForm("source"))
+	target := strings.TrimSpace(c.PostForm("target"))
+
+	if !isWebURL(source) || !isWebURL(target) {
+		c.String(http.StatusBadRequest, "source and target must be http(s) urls")
+		return
+	}
+	if source == target {
+		c.String(http.StatusBadRequest, "source and target must differ")
+		return
+	}
+
+	post, ok := h.publishedPostByURL(target)
+	if !ok {
+		c.String(http.StatusBadRequest, "target does not accept webmentions")
+		return
+	}
+
+	// a source sending again means it changed, so it is verified again
+	wm := models.Webmention{PostID: post.ID, Source: source, Target: target, Status: models.WebmentionPending}
+	err := h.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source"}, {Name: "target"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "updated_at"}),
+	}).Create(&wm).Error
+	if err == nil && wm.ID == 0 {
+		err = h.DB.Where("source = ? AND target = ?", source, target).First(&wm).Error
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to store webmention")
+		return
+	}
+
+	h.Webmentions.Enqueue(wm.ID)
+	c.String(http.StatusAccepted, "Accepted")
+}
+
+// Admin webmentions
+
+func (h *Handler) AdminWebmentions(c *gin.Context) {
+	var mentions []models.Webmention
+	query := h.DB.Preload("Post").Order("updated_at DESC").Limit(100)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Find(&mentions)
+
+	h.render(c, http.StatusOK, "admin/webmentions.html", gin.H{
+		"webmentions": mentions,
+		"status":      c.Query("status"),
+		"title":       "Webmentions",
+	})
+}
+
+func (h *Handler) DeleteWebmention(c *gin.Context) {
+	var wm models.Webmention
+	if err := h.DB.First(&wm, c.Param("id")).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if err := h.DB.Delete(&wm).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Trigger", "webmentionDeleted")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/webmentions")
+}
+
+// Webmention helpers
+
+// postMentions groups the verified webmentions of a post the way post.html shows them
+func (h *Handler) postMentions(postID uint) gin.H {
+	var mentions []models.Webmention
+	h.DB.Where("post_id = ? AND status = ?", postID, models.WebmentionVerified).
+		Order("COALESCE(published, created_at) ASC").
+		Find(&mentions)
+
+	groups := map[string][]models.Webmention{}
+	for _, wm := range mentions {
+		switch wm.Kind {
+		case webmention.KindLike, webmention.KindRepost, webmention.KindReply:
+			groups[wm.Kind+"s"] = append(groups[wm.Kind+"s"], wm)
+		default:
+			groups["mentions"] = append(groups["mentions"], wm)
+		}
+	}
+
+	return gin.H{
+		"likes":    groups["likes"],
+		"reposts":  groups["reposts"],
+		"replies":  groups["replies"],
+		"mentions": groups["mentions"],
+		"count":    len(mentions),
+	}
+}
+
+// outboundLinks are the links in a post to pages on other sites
+func (h *Handler) outboundLinks(post models.Post) []string {
+	site := h.Settings.Get()
+	base, err := url.Parse(site.URL("/"))
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	for _, link := range webmention.Links(post.Content, base) {
+		if u, err := url.Parse(link); err == nil && !strings.EqualFold(u.Host, base.Host) {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,196 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is one email. Text is required, HTML is sent as an alternative
+// when set. Headers are added as they are, such as List-Unsubscribe.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Mailer sends email. SMTP is the real one; Log stands in when no server is
+// configured, so nothing is lost in development.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// PermanentError is a rejection that retrying will not fix, such as an
+// unknown recipient
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Config is the SMTP server mail goes through
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func ConfigFromEnv() Config {
+	get := func(name, fallback string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	return Config{
+		Host:     get("SMTP_HOST", ""),
+		Port:     get("SMTP_PORT", "587"),
+		Username: get("SMTP_USERNAME", ""),
+		Password: get("SMTP_PASSWORD", ""),
+		From:     get("SMTP_FROM", ""),
+	}
+}
+
+// New is the SMTP mailer for cfg, or the Log mailer when no host is set
+func New(cfg Config) (Mailer, error) {
+	if cfg.Host == "" {
+		return Log{}, nil
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("SMTP_FROM must be an email address: %w", err)
+	}
+	return &SMTP{Config: cfg}, nil
+}
+
+// SMTP sends through a server, upgrading to TLS when the server offers it
+type SMTP struct {
+	Config Config
+}
+
+func (s *SMTP) Send(msg Message) error {
+	from, err := mail.ParseAddress(s.Config.From)
+	if err != nil {
+		return &PermanentError{err}
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return &PermanentError{err}
+	}
+
+	msg.To = to.Address
+	body, err := compose(s.Config.From, msg)
+	if err != nil {
+		return &PermanentError{err}
+	}
+
+	var auth smtp.Auth
+	if s.Config.Username != "" {
+		auth = smtp.PlainAuth("", s.Config.Username, s.Config.Password, s.Config.Host)
+	}
+
+	err = smtp.SendMail(net.JoinHostPort(s.Config.Host, s.Config.Port), auth, from.Address, []string{to.Address}, body)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &PermanentError{err}
+	}
+	return err
+}
+
+// Log writes messages to the log instead of sending them
+type Log struct{}
+
+func (Log) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// Mailer helpers
+
+// compose renders msg as a MIME message, multipart when it has an html part
+func compose(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		// a line break in a value would start a header of its own
+		value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from))
+	header("MIME-Version", "1.0")
+	for key, value := range msg.Headers {
+		header(key, value)
+	}
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		return buf.Bytes(), writeQuoted(&buf, msg.Text)
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuoted(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuoted(w interface{ Write([]byte) (int, error) }, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(buf), domain)
+}
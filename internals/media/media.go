@@ -0,0 +1,94 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels caps width times height of image uploads. The header is checked
+// before anything is decoded, as a small file can claim a huge canvas.
+const MaxPixels = 50_000_000
+
+var (
+	ErrUnsupportedType = errors.New("unsupported file type")
+	ErrImageTooLarge   = errors.New("image dimensions too large")
+)
+
+// allowedTypes maps the sniffed content types we accept to the extension they are stored with
+var allowedTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"application/ogg": ".ogg",
+}
+
+// File is an upload that passed sniffing and is ready to be stored
+type File struct {
+	Data     []byte
+	Hash     string
+	MimeType string
+	Ext      string
+	Width    int
+	Height   int
+}
+
+// Inspect sniffs the content type from the bytes themselves, ignoring whatever
+// the client claimed, and reads image dimensions when it can
+func Inspect(data []byte) (*File, error) {
+	mimeType := http.DetectContentType(data)
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+
+	ext, ok := allowedTypes[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, mimeType)
+	}
+
+	sum := sha256.Sum256(data)
+	f := &File{
+		Data:     data,
+		Hash:     hex.EncodeToString(sum[:]),
+		MimeType: mimeType,
+		Ext:      ext,
+	}
+
+	if IsImage(mimeType) {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("read image header: %w", err)
+		}
+		if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+			return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height)
+		}
+		f.Width, f.Height = cfg.Width, cfg.Height
+	}
+
+	return f, nil
+}
+
+// Path is the storage key of the file, fanned out by hash prefix
+func (f *File) Path() string {
+	return fmt.Sprintf("%s/%s/%s%s", f.Hash[:2], f.Hash[2:4], f.Hash, f.Ext)
+}
+
+func IsImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
@@ -0,0 +1,255 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+)
+
+const jpegQuality = 85
+
+// Variant is a resized copy of an image upload
+type Variant struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Process re-encodes JPEG and PNG uploads, which drops EXIF, GPS and any other
+// embedded metadata, and renders a variant for every width smaller than the
+// original. JPEG orientation is applied to the pixels before the metadata
+// carrying it is thrown away. GIF and WebP keep their frames and get no
+// variants, but lose their metadata all the same. Other types are left
+// untouched.
+func (f *File) Process(widths []int) ([]Variant, error) {
+	switch f.MimeType {
+	case "image/gif":
+		return nil, f.stripGIF()
+	case "image/webp":
+		return nil, f.stripWebP()
+	case "image/jpeg", "image/png":
+	default:
+		return nil, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(f.Data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	if f.MimeType == "image/jpeg" {
+		src = applyOrientation(src, jpegOrientation(f.Data))
+	}
+
+	data, err := f.encode(src)
+	if err != nil {
+		return nil, err
+	}
+	f.Data = data
+	f.Width, f.Height = src.Bounds().Dx(), src.Bounds().Dy()
+
+	var variants []Variant
+	for _, width := range widths {
+		if width <= 0 || width >= f.Width {
+			continue
+		}
+		resized := Resize(src, width)
+		data, err := f.encode(resized)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, Variant{
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+			Data:   data,
+		})
+	}
+
+	return variants, nil
+}
+
+// VariantPath is where the variant of the given width is stored, next to the original
+func (f *File) VariantPath(width int) string {
+	return fmt.Sprintf("%s/%s/%s-%dw%s", f.Hash[:2], f.Hash[2:4], f.Hash, width, f.Ext)
+}
+
+func (f *File) encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if f.MimeType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Resize scales src down to the given width keeping the aspect ratio. Every
+// destination pixel is the area weighted average of the source pixels it
+// covers, which avoids the aliasing of nearest neighbour sampling.
+func Resize(src image.Image, width int) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	height := max(1, (sh*width+sw/2)/sw)
+
+	rgba := toRGBA(src)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	xScale := float64(sw) / float64(width)
+	yScale := float64(sh) / float64(height)
+
+	for dy := 0; dy < height; dy++ {
+		y0 := float64(dy) * yScale
+		y1 := y0 + yScale
+		for dx := 0; dx < width; dx++ {
+			x0 := float64(dx) * xScale
+			x1 := x0 + xScale
+
+			var r, g, b, a, total float64
+			for sy := int(y0); sy < int(math.Ceil(y1)) && sy < sh; sy++ {
+				wy := overlap(float64(sy), y0, y1)
+				for sx := int(x0); sx < int(math.Ceil(x1)) && sx < sw; sx++ {
+					w := wy * overlap(float64(sx), x0, x1)
+					i := rgba.PixOffset(sx, sy)
+					r += float64(rgba.Pix[i]) * w
+					g += float64(rgba.Pix[i+1]) * w
+					b += float64(rgba.Pix[i+2]) * w
+					a += float64(rgba.Pix[i+3]) * w
+					total += w
+				}
+			}
+
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i] = uint8(r/total + 0.5)
+			dst.Pix[i+1] = uint8(g/total + 0.5)
+			dst.Pix[i+2] = uint8(b/total + 0.5)
+			dst.Pix[i+3] = uint8(a/total + 0.5)
+		}
+	}
+
+	return dst
+}
+
+// overlap is how much of the unit cell starting at p lies inside [lo, hi)
+func overlap(p, lo, hi float64) float64 {
+	return max(0, min(p+1, hi)-max(p, lo))
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// applyOrientation rotates and flips the pixels according to the EXIF orientation value
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	in := toRGBA(src)
+	w, h := in.Bounds().Dx(), in.Bounds().Dy()
+
+	ow, oh := w, h
+	if orientation >= 5 {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var nx, ny int
+			switch orientation {
+			case 2:
+				nx, ny = w-1-x, y
+			case 3:
+				nx, ny = w-1-x, h-1-y
+			case 4:
+				nx, ny = x, h-1-y
+			case 5:
+				nx, ny = y, x
+			case 6:
+				nx, ny = h-1-y, x
+			case 7:
+				nx, ny = h-1-y, w-1-x
+			case 8:
+				nx, ny = y, w-1-x
+			}
+			copy(out.Pix[out.PixOffset(nx, ny):out.PixOffset(nx, ny)+4], in.Pix[in.PixOffset(x, y):in.PixOffset(x, y)+4])
+		}
+	}
+
+	return out
+}
+
+// jpegOrientation reads the orientation tag from the EXIF block of a JPEG, or 1 when there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// image data starts, no more metadata segments
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
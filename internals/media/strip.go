@@ -0,0 +1,76 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/gif"
+)
+
+// VP8X flags announcing metadata chunks
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+var errInvalidWebP = errors.New("invalid webp file")
+
+// stripGIF re-encodes every frame, which keeps the animation but drops
+// comments and application extensions other than the loop count
+func (f *File) stripGIF() error {
+	g, err := gif.DecodeAll(bytes.NewReader(f.Data))
+	if err != nil {
+		return fmt.Errorf("decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return fmt.Errorf("encode image: %w", err)
+	}
+	f.Data = buf.Bytes()
+	f.Width, f.Height = g.Config.Width, g.Config.Height
+	return nil
+}
+
+// stripWebP rewrites the RIFF container without its EXIF and XMP chunks. The
+// image data is copied as it is, there being no WebP encoder to re-encode with.
+func (f *File) stripWebP() error {
+	data := f.Data
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return errInvalidWebP
+	}
+	end := 8 + int(binary.LittleEndian.Uint32(data[4:]))
+	if end > len(data) {
+		return errInvalidWebP
+	}
+
+	out := append([]byte(nil), data[:12]...)
+	for i := 12; i < end; {
+		if i+8 > end {
+			return errInvalidWebP
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		next := i + 8 + size + size%2
+		if i+8+size > end {
+			return errInvalidWebP
+		}
+
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:min(next, end)]...)
+			if size > 0 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:min(next, end)]...)
+		}
+		i = next
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	f.Data = out
+	return nil
+}
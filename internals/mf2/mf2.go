@@ -0,0 +1,537 @@
+package mf2
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Data is a parsed document in the shape of the microformats2 JSON output,
+// https://microformats.org/wiki/microformats2-parsing
+type Data struct {
+	Items []*Item             `json:"items"`
+	Rels  map[string][]string `json:"rels"`
+}
+
+// Item is one microformat. Property values are strings, *Item for nested
+// microformats and HTML for e-* properties.
+type Item struct {
+	Type       []string         `json:"type"`
+	Properties map[string][]any `json:"properties"`
+	Children   []*Item          `json:"children,omitempty"`
+	// Value is set on items nested as a property, the plain value of that property
+	Value string `json:"value,omitempty"`
+}
+
+// HTML is the value of an e-* property
+type HTML struct {
+	HTML  string `json:"html"`
+	Value string `json:"value"`
+}
+
+// Parse reads an html document, resolving relative urls against base
+func Parse(r io.Reader, base *url.URL) (*Data, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNode(doc, base), nil
+}
+
+// ParseNode extracts the microformats below an already parsed node
+func ParseNode(root *html.Node, base *url.URL) *Data {
+	p := &parser{base: base, data: &Data{Items: []*Item{}, Rels: map[string][]string{}}}
+	if b := findBase(root); b != "" {
+		p.base = p.resolve(b)
+	}
+	p.walk(root, nil)
+	return p.data
+}
+
+// HasType reports whether the item is of type, such as "h-entry"
+func (i *Item) HasType(typ string) bool {
+	for _, t := range i.Type {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the first value of prop as text: strings as they are, the
+// value of nested items and the text of html values
+func (i *Item) Get(prop string) string {
+	values := i.Properties[prop]
+	if len(values) == 0 {
+		return ""
+	}
+	return text(values[0])
+}
+
+// Strings returns every value of prop as text
+func (i *Item) Strings(prop string) []string {
+	var out []string
+	for _, v := range i.Properties[prop] {
+		out = append(out, text(v))
+	}
+	return out
+}
+
+// Item returns the first value of prop that is a nested microformat
+func (i *Item) Item(prop string) *Item {
+	for _, v := range i.Properties[prop] {
+		if item, ok := v.(*Item); ok {
+			return item
+		}
+	}
+	return nil
+}
+
+// Find lists every item of type in the document, depth first, including
+// children and items nested as properties
+func (d *Data) Find(typ string) []*Item {
+	var found []*Item
+	var visit func(items []*Item)
+	visit = func(items []*Item) {
+		for _, item := range items {
+			if item.HasType(typ) {
+				found = append(found, item)
+			}
+			for _, values := range item.Properties {
+				for _, v := range values {
+					if nested, ok := v.(*Item); ok {
+						visit([]*Item{nested})
+					}
+				}
+			}
+			visit(item.Children)
+		}
+	}
+	visit(d.Items)
+	return found
+}
+
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case *Item:
+		if v.Value != "" {
+			return v.Value
+		}
+		return v.Get("name")
+	case HTML:
+		return v.Value
+	}
+	return ""
+}
+
+// Parser
+
+type parser struct {
+	base *url.URL
+	data *Data
+}
+
+// walk looks for microformats below n. parent is the item whose properties
+// and children the elements found belong to, nil at the top level.
+func (p *parser) walk(n *html.Node, parent *Item) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		p.collectRel(c)
+
+		roots, props := classes(c)
+		if len(roots) > 0 {
+			item := p.parseItem(c, roots)
+			switch {
+			case parent != nil && len(props) > 0:
+				for _, prop := range props {
+					nested := *item
+					nested.Value = p.nestedValue(c, prop, item)
+					parent.Properties[prop.name] = append(parent.Properties[prop.name], &nested)
+				}
+			case parent != nil:
+				parent.Children = append(parent.Children, item)
+			default:
+				p.data.Items = append(p.data.Items, item)
+			}
+			continue
+		}
+
+		if parent != nil {
+			for _, prop := range props {
+				parent.Properties[prop.name] = append(parent.Properties[prop.name], p.propertyValue(c, prop.prefix))
+			}
+		}
+		p.walk(c, parent)
+	}
+}
+
+func (p *parser) parseItem(n *html.Node, types []string) *Item {
+	item := &Item{Type: types, Properties: map[string][]any{}}
+	p.walk(n, item)
+	p.implyProperties(n, item)
+	return item
+}
+
+// implyProperties adds name, photo and url when the item does not give them,
+// following the simplified rules of the parsing spec
+func (p *parser) implyProperties(n *html.Node, item *Item) {
+	if _, ok := item.Properties["name"]; !ok && !hasPrefixedProperty(n, "p-", "e-") && !hasNestedItem(item) {
+		name := ""
+		switch {
+		case n.DataAtom == atom.Img || n.DataAtom == atom.Area:
+			name = attr(n, "alt")
+		case n.DataAtom == atom.Abbr && attr(n, "title") != "":
+			name = attr(n, "title")
+		default:
+			name = textContent(n)
+		}
+		item.Properties["name"] = []any{strings.TrimSpace(name)}
+	}
+
+	if _, ok := item.Properties["photo"]; !ok && !hasPrefixedProperty(n, "u-") {
+		if img := impliedChild(n, atom.Img, "src"); img != nil {
+			item.Properties["photo"] = []any{p.resolveString(attr(img, "src"))}
+		}
+	}
+
+	if _, ok := item.Properties["url"]; !ok && !hasPrefixedProperty(n, "u-") {
+		if a := impliedChild(n, atom.A, "href"); a != nil {
+			item.Properties["url"] = []any{p.resolveString(attr(a, "href"))}
+		}
+	}
+}
+
+func (p *parser) nestedValue(n *html.Node, prop property, item *Item) string {
+	switch prop.prefix {
+	case "p":
+		if name := item.Get("name"); name != "" {
+			return name
+		}
+	case "u":
+		if u := item.Get("url"); u != "" {
+			return u
+		}
+	}
+	return text(p.propertyValue(n, prop.prefix))
+}
+
+func (p *parser) propertyValue(n *html.Node, prefix string) any {
+	switch prefix {
+	case "u":
+		for _, a := range urlAttributes[n.DataAtom] {
+			if v, ok := attrOK(n, a); ok {
+				return p.resolveString(v)
+			}
+		}
+		return p.plainValue(n)
+	case "dt":
+		if v := valueClassPattern(n); v != "" {
+			return v
+		}
+		switch n.DataAtom {
+		case atom.Time, atom.Ins, atom.Del:
+			if v, ok := attrOK(n, "datetime"); ok {
+				return v
+			}
+		case atom.Abbr:
+			if v, ok := attrOK(n, "title"); ok {
+				return v
+			}
+		case atom.Data, atom.Input:
+			if v, ok := attrOK(n, "value"); ok {
+				return v
+			}
+		}
+		return strings.TrimSpace(textContent(n))
+	case "e":
+		var b strings.Builder
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			html.Render(&b, c)
+		}
+		return HTML{HTML: strings.TrimSpace(b.String()), Value: strings.TrimSpace(textContent(n))}
+	default:
+		return p.plainValue(n)
+	}
+}
+
+// plainValue is the value of a p-* property
+func (p *parser) plainValue(n *html.Node) string {
+	if v := valueClassPattern(n); v != "" {
+		return v
+	}
+	switch n.DataAtom {
+	case atom.Abbr, atom.Link:
+		if v, ok := attrOK(n, "title"); ok {
+			return v
+		}
+	case atom.Data, atom.Input:
+		if v, ok := attrOK(n, "value"); ok {
+			return v
+		}
+	case atom.Img, atom.Area:
+		if v, ok := attrOK(n, "alt"); ok {
+			return v
+		}
+	}
+	return strings.TrimSpace(textContent(n))
+}
+
+func (p *parser) collectRel(n *html.Node) {
+	if n.DataAtom != atom.A && n.DataAtom != atom.Link && n.DataAtom != atom.Area {
+		return
+	}
+	href, ok := attrOK(n, "href")
+	if !ok {
+		return
+	}
+	for _, rel := range strings.Fields(attr(n, "rel")) {
+		p.data.Rels[rel] = append(p.data.Rels[rel], p.resolveString(href))
+	}
+}
+
+func (p *parser) resolve(ref string) *url.URL {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return p.base
+	}
+	if p.base == nil {
+		return u
+	}
+	return p.base.ResolveReference(u)
+}
+
+func (p *parser) resolveString(ref string) string {
+	if u := p.resolve(ref); u != nil {
+		return u.String()
+	}
+	return ref
+}
+
+// Parser helpers
+
+type property struct {
+	prefix string
+	name   string
+}
+
+var urlAttributes = map[atom.Atom][]string{
+	atom.A:      {"href"},
+	atom.Area:   {"href"},
+	atom.Link:   {"href"},
+	atom.Img:    {"src"},
+	atom.Audio:  {"src"},
+	atom.Video:  {"src", "poster"},
+	atom.Source: {"src"},
+	atom.Iframe: {"src"},
+	atom.Object: {"data"},
+}
+
+// classes splits the class attribute into root types and properties
+func classes(n *html.Node) (roots []string, props []property) {
+	seen := map[string]bool{}
+	for _, class := range strings.Fields(attr(n, "class")) {
+		if seen[class] {
+			continue
+		}
+		seen[class] = true
+
+		prefix, name, ok := strings.Cut(class, "-")
+		if !ok || !validName(name) {
+			continue
+		}
+		switch prefix {
+		case "h":
+			roots = append(roots, class)
+		case "p", "u", "dt", "e":
+			props = append(props, property{prefix: prefix, name: name})
+		}
+	}
+	return roots, props
+}
+
+// validName accepts the lowercase, dash separated names microformats use
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// valueClassPattern joins the values of class="value" children, when there are any
+func valueClassPattern(n *html.Node) string {
+	var parts []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || !hasClass(c, "value") {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Img, atom.Area:
+			parts = append(parts, attr(c, "alt"))
+		case atom.Data:
+			parts = append(parts, firstNonEmpty(attr(c, "value"), textContent(c)))
+		case atom.Abbr:
+			parts = append(parts, firstNonEmpty(attr(c, "title"), textContent(c)))
+		default:
+			parts = append(parts, textContent(c))
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, ""))
+}
+
+// hasPrefixedProperty reports whether any element below n, outside nested
+// microformats, has a property class with one of the prefixes
+func hasPrefixedProperty(n *html.Node, prefixes ...string) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		roots, props := classes(c)
+		for _, prop := range props {
+			for _, prefix := range prefixes {
+				if prop.prefix+"-" == prefix {
+					return true
+				}
+			}
+		}
+		if len(roots) == 0 && hasPrefixedProperty(c, prefixes...) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasNestedItem(item *Item) bool {
+	if len(item.Children) > 0 {
+		return true
+	}
+	for _, values := range item.Properties {
+		for _, v := range values {
+			if _, ok := v.(*Item); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// impliedChild finds the element an implied photo or url comes from: n itself,
+// its only child of that kind, or the only child of its only child
+func impliedChild(n *html.Node, tag atom.Atom, attribute string) *html.Node {
+	if n.DataAtom == tag {
+		if _, ok := attrOK(n, attribute); ok {
+			return n
+		}
+		return nil
+	}
+	for depth, current := 0, n; depth < 2; depth++ {
+		child := onlyElementChild(current)
+		if child == nil || hasRootClass(child) {
+			return nil
+		}
+		if child.DataAtom == tag {
+			if _, ok := attrOK(child, attribute); ok {
+				return child
+			}
+			return nil
+		}
+		current = child
+	}
+	return nil
+}
+
+func onlyElementChild(n *html.Node) *html.Node {
+	var only *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if only != nil {
+			return nil
+		}
+		only = c
+	}
+	return only
+}
+
+func hasRootClass(n *html.Node) bool {
+	roots, _ := classes(n)
+	return len(roots) > 0
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent is the text below n, with images replaced by their alt text and
+// scripts and styles left out
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style || n.DataAtom == atom.Template):
+			return
+		case n.Type == html.ElementNode && n.DataAtom == atom.Img:
+			b.WriteString(attr(n, "alt"))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return b.String()
+}
+
+func findBase(n *html.Node) string {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Base {
+		return attr(n, "href")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if href := findBase(c); href != "" {
+			return href
+		}
+	}
+	return ""
+}
+
+func attr(n *html.Node, name string) string {
+	v, _ := attrOK(n, name)
+	return v
+}
+
+func attrOK(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"RustyBits/internals/pow"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProofOfWork rejects requests that do not carry a solved challenge from v,
+// for public forms that would otherwise be easy to submit from a script.
+// reject answers a rejected request, normally by showing the form again with
+// the error; without one the error is sent as JSON.
+func ProofOfWork(v *pow.Verifier, reject func(c *gin.Context, err error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !v.Enabled() {
+			c.Next()
+			return
+		}
+
+		if err := v.Verify(c.PostForm(pow.ChallengeField), c.PostForm(pow.SolutionField)); err != nil {
+			if reject != nil {
+				reject(c, err)
+			} else {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			}
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
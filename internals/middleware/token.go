@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"RustyBits/internals/apitoken"
+	"RustyBits/internals/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TokenRequired authenticates a request by its bearer token, from the
+// Authorization header or, as Micropub allows, an access_token form field.
+// The token's user becomes the current user and the token itself is set as
+// "api_token" so handlers can check its scope.
+func TokenRequired(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			token = c.PostForm("access_token")
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "error_description": "no access token"})
+			c.Abort()
+			return
+		}
+
+		var record models.APIToken
+		if err := db.Preload("User").Where("hash = ?", apitoken.Hash(token)).First(&record).Error; err != nil || record.User == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "error_description": "invalid access token"})
+			c.Abort()
+			return
+		}
+		db.Model(&record).UpdateColumn("last_used_at", time.Now())
+
+		c.Set("user_id", record.UserID)
+		c.Set("user", *record.User)
+		c.Set("api_token", record)
+		c.Next()
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+type Category struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Name        string     `json:"name" gorm:"not null"`
+	Slug        string     `json:"slug" gorm:"uniqueIndex;not null"`
+	Description string     `json:"description"`
+	ParentID    *uint      `json:"parent_id" gorm:"index"`
+	Parent      *Category  `json:"-"`
+	Children    []Category `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+	Posts       []Post     `json:"-"`
+}
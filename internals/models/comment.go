@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Comment statuses
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentSpam     = "spam"
+)
+
+// Comment is a reader's response to a post, optionally replying to another
+// comment on the same post. Only approved comments are shown.
+type Comment struct {
+	ID       uint      `json:"id" gorm:"primaryKey"`
+	PostID   uint      `json:"post_id" gorm:"index;not null"`
+	Post     *Post     `json:"-"`
+	ParentID *uint     `json:"parent_id" gorm:"index"`
+	Replies  []Comment `json:"replies,omitempty" gorm:"foreignKey:ParentID"`
+
+	Name    string `json:"name" gorm:"not null"`
+	Email   string `json:"-"`
+	Website string `json:"website"`
+	Content string `json:"content" gorm:"type:text;not null"`
+	Status  string `json:"status" gorm:"index;not null"`
+
+	// SpamScore is the filter's estimate when the comment arrived, from 0 to 1.
+	// TrainedAs remembers which class a moderator taught the filter it belongs
+	// to, so changing their mind can undo that.
+	SpamScore float64 `json:"spam_score"`
+	TrainedAs string  `json:"-"`
+
+	// RemoteID is the ActivityPub id of a reply that came from the fediverse,
+	// RemoteAuthor the actor who wrote it and the only one who may edit or
+	// delete it
+	RemoteID     string `json:"-" gorm:"index"`
+	RemoteAuthor string `json:"-" gorm:"index"`
+
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
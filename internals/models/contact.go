@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Contact message statuses
+const (
+	MessageUnread   = "unread"
+	MessageRead     = "read"
+	MessageArchived = "archived"
+	MessageSpam     = "spam"
+)
+
+// ContactMessage is a message sent through the contact form. It is never
+// shown publicly, only in the admin inbox.
+type ContactMessage struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	Name    string `json:"name" gorm:"not null"`
+	Email   string `json:"email" gorm:"not null"`
+	Subject string `json:"subject"`
+	Body    string `json:"body" gorm:"type:text;not null"`
+	Status  string `json:"status" gorm:"index;not null"`
+
+	// SpamScore and TrainedAs work as they do for comments
+	SpamScore float64 `json:"spam_score"`
+	TrainedAs string  `json:"-"`
+
+	// ForwardedAt is when the message was emailed to the contact address
+	ForwardedAt *time.Time `json:"forwarded_at"`
+
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Follower is a fediverse account following the blog. Posts are delivered to
+// its inbox, or to its server's shared inbox when it has one.
+type Follower struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	ActorID string `json:"actor_id" gorm:"uniqueIndex;not null"`
+	Inbox   string `json:"inbox" gorm:"not null"`
+	// Handle is how the account is shown, @user@host
+	Handle    string    `json:"handle"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
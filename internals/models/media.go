@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Media is an uploaded file. Files are stored under a storage key derived from
+// the sha256 of their content, so the same file uploaded twice is stored once,
+// or once public and once private.
+type Media struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Hash       string    `json:"hash" gorm:"uniqueIndex:idx_media_hash_private;not null"`
+	Path       string    `json:"path" gorm:"not null"`
+	FileName   string    `json:"file_name"`
+	MimeType   string    `json:"mime_type" gorm:"index"`
+	Size       int64     `json:"size"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	AltText    string    `json:"alt_text"`
+	Private    bool      `json:"private" gorm:"uniqueIndex:idx_media_hash_private;default:false"`
+	UploaderID uint      `json:"uploader_id" gorm:"index"`
+	Uploader   *User     `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	Variants []MediaVariant `json:"variants,omitempty"`
+}
+
+// MediaVariant is a resized copy of an image, used for srcset
+type MediaVariant struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	MediaID uint   `json:"media_id" gorm:"index;not null"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Path    string `json:"path" gorm:"not null"`
+	Size    int64  `json:"size"`
+}
+
+// MediaUsage records that a post embeds a media file. The rows for a post are
+// rebuilt from its content every time it is saved.
+type MediaUsage struct {
+	MediaID uint  `json:"media_id" gorm:"primaryKey"`
+	PostID  uint  `json:"post_id" gorm:"primaryKey;index"`
+	Post    *Post `json:"post,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+// Menu is a named set of navigation links, e.g. "header" or "footer"
+type Menu struct {
+	ID    uint       `json:"id" gorm:"primaryKey"`
+	Name  string     `json:"name" gorm:"uniqueIndex;not null"`
+	Items []MenuItem `json:"items,omitempty"`
+}
+
+// MenuItem links to a page, post, tag or external url. Items can be nested one
+// level deep under another item of the same menu.
+type MenuItem struct {
+	ID       uint       `json:"id" gorm:"primaryKey"`
+	MenuID   uint       `json:"menu_id" gorm:"index;not null"`
+	ParentID *uint      `json:"parent_id" gorm:"index"`
+	Label    string     `json:"label" gorm:"not null"`
+	Kind     string     `json:"kind" gorm:"not null"`
+	TargetID *uint      `json:"target_id"`
+	URL      string     `json:"url"`
+	Position int        `json:"position" gorm:"default:0"`
+	Children []MenuItem `json:"children,omitempty" gorm:"foreignKey:ParentID"`
+}
+
+const (
+	MenuItemPage = "page"
+	MenuItemPost = "post"
+	MenuItemTag  = "tag"
+	MenuItemURL  = "url"
+)
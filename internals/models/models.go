@@ -12,11 +12,40 @@ type Post struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Tags      []Tag     `json:"tags" gorm:"many2many:post_tags;"`
+
+	CategoryID *uint     `json:"category_id" gorm:"index"`
+	Category   *Category `json:"category,omitempty" form:"-"`
+
+	SeriesID    *uint   `json:"series_id" gorm:"index"`
+	SeriesOrder int     `json:"series_order"`
+	Series      *Series `json:"series,omitempty" form:"-"`
+
+	AuthorID *uint `json:"author_id" gorm:"index" form:"-"`
+	Author   *User `json:"author,omitempty" form:"-"`
+
+	FeaturedImageID *uint  `json:"featured_image_id" gorm:"index"`
+	FeaturedImage   *Media `json:"featured_image,omitempty" form:"-"`
+
+	// overrides for search engines and social previews, empty means derive from the post
+	SEOTitle        string `json:"seo_title"`
+	MetaDescription string `json:"meta_description"`
+	CanonicalURL    string `json:"canonical_url"`
+
+	// CommentsDisabled turns comments off for this post only, see Site.CommentsCloseDays
+	CommentsDisabled bool `json:"comments_disabled"`
+
+	// PublishedAt is when the post was first made public. Posts published
+	// before it was recorded leave it empty.
+	PublishedAt *time.Time `json:"published_at" gorm:"index" form:"-"`
+
+	// SocialCardKey is the storage key of the last rendered social card
+	SocialCardKey string `json:"-" form:"-"`
 }
 
 type User struct {
 	ID       uint   `json:"id" gorm:"primaryKey"`
 	Email    string `json:"email" gorm:"uniqueIndex;not null"`
+	Name     string `json:"name"`
 	Password string `json:"-" gorm:"not null"`
 }
 
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Subscriber statuses
+const (
+	SubscriberPending      = "pending"
+	SubscriberConfirmed    = "confirmed"
+	SubscriberUnsubscribed = "unsubscribed"
+)
+
+// How often a subscriber hears from us
+const (
+	FrequencyEachPost = "post"
+	FrequencyWeekly   = "weekly"
+)
+
+// Subscriber is an email address signed up for the newsletter. Nothing but
+// the confirmation is sent until the address is confirmed.
+type Subscriber struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	Email     string `json:"email" gorm:"uniqueIndex;not null"`
+	Status    string `json:"status" gorm:"index;not null"`
+	Frequency string `json:"frequency" gorm:"not null"`
+
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+	// LastDigestAt is when the last weekly digest was put together
+	LastDigestAt *time.Time `json:"last_digest_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Email kinds
+const (
+	EmailConfirm = "confirm"
+	EmailPost    = "post"
+	EmailDigest  = "digest"
+)
+
+// Email delivery statuses
+const (
+	EmailPending  = "pending"
+	EmailRetrying = "retrying"
+	EmailSent     = "sent"
+	EmailFailed   = "failed"
+	// EmailSkipped means the subscriber left before the email went out
+	EmailSkipped = "skipped"
+)
+
+// EmailDelivery is one email to one subscriber, rendered when it is queued
+// so a retry sends exactly the same message
+type EmailDelivery struct {
+	ID           uint        `json:"id" gorm:"primaryKey"`
+	SubscriberID uint        `json:"subscriber_id" gorm:"index;not null"`
+	Subscriber   *Subscriber `json:"-"`
+	Kind         string      `json:"kind" gorm:"index;not null"`
+	PostID       *uint       `json:"post_id" gorm:"index"`
+
+	To             string `json:"to" gorm:"not null"`
+	Subject        string `json:"subject"`
+	Text           string `json:"-" gorm:"type:text"`
+	HTML           string `json:"-" gorm:"type:text"`
+	UnsubscribeURL string `json:"-"`
+
+	Status        string     `json:"status" gorm:"index;not null"`
+	Attempts      int        `json:"attempts"`
+	Error         string     `json:"error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Page is a standalone page served from the site root, kept apart from posts
+// so it never shows up in listings or feeds
+type Page struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Title     string    `json:"title" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	Content   string    `json:"content" gorm:"type:text"`
+	Published bool      `json:"published" gorm:"default:false"`
+	ShowInNav bool      `json:"show_in_nav" gorm:"default:false"`
+	NavOrder  int       `json:"nav_order" gorm:"default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
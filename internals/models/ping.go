@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Ping statuses
+const (
+	PingPending  = "pending"
+	PingRetrying = "retrying"
+	PingSent     = "sent"
+	PingFailed   = "failed"
+	// PingSkipped means there was nobody to notify, such as a linked page
+	// without a webmention endpoint
+	PingSkipped = "skipped"
+)
+
+// PingLog is one outbound notification, such as a WebSub publish or an
+// IndexNow submission, together with the outcome of its latest attempt
+type PingLog struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Kind          string     `json:"kind" gorm:"index;not null"`
+	Endpoint      string     `json:"endpoint" gorm:"not null"`
+	ContentType   string     `json:"content_type"`
+	Payload       string     `json:"payload" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"index;not null"`
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code"`
+	Error         string     `json:"error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
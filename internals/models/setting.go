@@ -0,0 +1,7 @@
+package models
+
+// Setting is a single site setting stored as a key/value pair
+type Setting struct {
+	Key   string `json:"key" gorm:"primaryKey"`
+	Value string `json:"value" gorm:"type:text"`
+}
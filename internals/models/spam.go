@@ -0,0 +1,9 @@
+package models
+
+// SpamToken counts how many trained spam and ham messages contained a token.
+// The counts are what the spam filter's probabilities are computed from.
+type SpamToken struct {
+	Token string `json:"token" gorm:"primaryKey"`
+	Spam  int    `json:"spam"`
+	Ham   int    `json:"ham"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// APIToken lets a client act as a user without a session, such as a Micropub
+// app. Only a hash of the token is kept; the token itself is shown once.
+type APIToken struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	Name   string `json:"name" gorm:"not null"`
+	UserID uint   `json:"user_id" gorm:"index;not null"`
+	User   *User  `json:"-"`
+	Hash   string `json:"-" gorm:"uniqueIndex;not null"`
+	// Scope is the space separated list of what the token may do, see apitoken
+	Scope string `json:"scope"`
+
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Webhook events
+const (
+	EventPostCreated     = "post.created"
+	EventPostUpdated     = "post.updated"
+	EventPostPublished   = "post.published"
+	EventPostUnpublished = "post.unpublished"
+	EventPostDeleted     = "post.deleted"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{EventPostCreated, EventPostUpdated, EventPostPublished, EventPostUnpublished, EventPostDeleted}
+
+// Webhook is an endpoint told about content changes, with every payload
+// signed using its secret
+type Webhook struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	URL    string `json:"url" gorm:"not null"`
+	Secret string `json:"-" gorm:"not null"`
+	// Events is the comma separated list of events sent
+	Events string `json:"events"`
+	Active bool   `json:"active" gorm:"default:true"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending  = "pending"
+	DeliveryRetrying = "retrying"
+	DeliverySent     = "sent"
+	DeliveryFailed   = "failed"
+)
+
+// WebhookDelivery is one event sent to one webhook, together with the outcome
+// of its latest attempt
+type WebhookDelivery struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	WebhookID     uint       `json:"webhook_id" gorm:"index;not null"`
+	Event         string     `json:"event" gorm:"index;not null"`
+	Payload       string     `json:"payload" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"index;not null"`
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code"`
+	Error         string     `json:"error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
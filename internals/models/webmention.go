@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Webmention statuses
+const (
+	WebmentionPending  = "pending"
+	WebmentionVerified = "verified"
+	WebmentionRejected = "rejected"
+)
+
+// Webmention is a page elsewhere that links to one of our posts. It is only
+// shown once its source has been fetched and found to link here.
+type Webmention struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	PostID uint   `json:"post_id" gorm:"index;not null"`
+	Post   *Post  `json:"-"`
+	Source string `json:"source" gorm:"uniqueIndex:idx_webmention_source_target;not null"`
+	Target string `json:"target" gorm:"uniqueIndex:idx_webmention_source_target;not null"`
+	Status string `json:"status" gorm:"index;not null"`
+
+	// what the source says about itself, read from its microformats
+	Kind        string     `json:"kind"`
+	AuthorName  string     `json:"author_name"`
+	AuthorURL   string     `json:"author_url"`
+	AuthorPhoto string     `json:"author_photo"`
+	Content     string     `json:"content" gorm:"type:text"`
+	URL         string     `json:"url"`
+	Published   *time.Time `json:"published"`
+
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,139 @@
+package newsletter
+
+import (
+	"RustyBits/internals/mailer"
+	"RustyBits/internals/models"
+	"RustyBits/internals/settings"
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// summaryLength is how much of a post without an excerpt is quoted
+const summaryLength = 300
+
+var (
+	tagPattern   = regexp.MustCompile(`<[^>]*>`)
+	spacePattern = regexp.MustCompile(`\s+`)
+)
+
+type messagePost struct {
+	Title   string
+	URL     string
+	Summary string
+}
+
+// messageTemplate is the html part of every email. Confirmations have a
+// Link and no Posts, the others list Posts and an Unsubscribe link.
+var messageTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif; max-width: 600px; margin: 0 auto;">
+<p>{{.Intro}}</p>
+{{if .Link}}<p><a href="{{.Link}}">{{.LinkText}}</a></p>{{end}}
+{{range .Posts}}<h2><a href="{{.URL}}">{{.Title}}</a></h2>
+{{if .Summary}}<p>{{.Summary}}</p>{{end}}
+<p><a href="{{.URL}}">Read more</a></p>
+{{end}}{{if .Outro}}<p><small>{{.Outro}}</small></p>{{end}}
+{{if .Unsubscribe}}<p><small><a href="{{.Unsubscribe}}">Unsubscribe</a></small></p>{{end}}
+</body></html>`))
+
+type messageData struct {
+	Intro       string
+	Link        string
+	LinkText    string
+	Posts       []messagePost
+	Outro       string
+	Unsubscribe string
+}
+
+func confirmMessage(site settings.Site, sub models.Subscriber, link string) mailer.Message {
+	frequency := "every new post"
+	if sub.Frequency == models.FrequencyWeekly {
+		frequency = "a weekly digest of new posts"
+	}
+	data := messageData{
+		Intro:    fmt.Sprintf("Please confirm that you want %s from %s by email.", frequency, site.Title),
+		Link:     link,
+		LinkText: "Confirm my subscription",
+		Outro:    "If you did not sign up, ignore this email and nothing more will be sent.",
+	}
+
+	text := fmt.Sprintf("%s\n\n%s\n\n%s\n", data.Intro, link, data.Outro)
+	return compose("Confirm your subscription to "+site.Title, text, data)
+}
+
+func postMessage(site settings.Site, post models.Post, unsubscribe string) mailer.Message {
+	data := messageData{
+		Intro:       "New on " + site.Title + ":",
+		Posts:       []messagePost{toMessagePost(site, post)},
+		Unsubscribe: unsubscribe,
+	}
+	return compose(post.Title, textBody(data), data)
+}
+
+func digestMessage(site settings.Site, posts []models.Post, unsubscribe string) mailer.Message {
+	data := messageData{
+		Intro:       fmt.Sprintf("This week on %s:", site.Title),
+		Unsubscribe: unsubscribe,
+	}
+	for _, post := range posts {
+		data.Posts = append(data.Posts, toMessagePost(site, post))
+	}
+	return compose(fmt.Sprintf("%s: this week's posts", site.Title), textBody(data), data)
+}
+
+// Message helpers
+
+func compose(subject, text string, data messageData) mailer.Message {
+	msg := mailer.Message{Subject: subject, Text: text}
+	var buf bytes.Buffer
+	if err := messageTemplate.Execute(&buf, data); err == nil {
+		msg.HTML = buf.String()
+	}
+	return msg
+}
+
+func textBody(data messageData) string {
+	var b strings.Builder
+	b.WriteString(data.Intro + "\n\n")
+	for _, post := range data.Posts {
+		b.WriteString(post.Title + "\n")
+		if post.Summary != "" {
+			b.WriteString(post.Summary + "\n")
+		}
+		b.WriteString(post.URL + "\n\n")
+	}
+	if data.Unsubscribe != "" {
+		b.WriteString("Unsubscribe: " + data.Unsubscribe + "\n")
+	}
+	return b.String()
+}
+
+func toMessagePost(site settings.Site, post models.Post) messagePost {
+	return messagePost{
+		Title:   post.Title,
+		URL:     site.URL("/posts/" + post.Slug),
+		Summary: summary(post),
+	}
+}
+
+// summary is the post's excerpt, or the start of its text without markup
+func summary(post models.Post) string {
+	if strings.TrimSpace(post.Excerpt) != "" {
+		return post.Excerpt
+	}
+	text := html.UnescapeString(tagPattern.ReplaceAllString(post.Content, " "))
+	text = strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+
+	runes := []rune(text)
+	if len(runes) <= summaryLength {
+		return text
+	}
+	cut := string(runes[:summaryLength])
+	if i := strings.LastIndex(cut, " "); i > summaryLength/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
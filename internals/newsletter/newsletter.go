@@ -0,0 +1,421 @@
+package newsletter
+
+import (
+	"RustyBits/internals/mailer"
+	"RustyBits/internals/models"
+	"RustyBits/internals/settings"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// confirmTTL is how long a confirmation link works
+const confirmTTL = 7 * 24 * time.Hour
+
+// confirmEvery limits how often one address is sent a confirmation, so the
+// form cannot be used to flood someone's inbox
+const confirmEvery = 10 * time.Minute
+
+// digestPeriod is how long weekly subscribers wait between digests
+const digestPeriod = 7 * 24 * time.Hour
+
+// maxDigestPosts is how many posts one digest lists
+const maxDigestPosts = 20
+
+var (
+	ErrInvalidEmail = errors.New("not a valid email address")
+	ErrInvalidToken = errors.New("invalid or outdated link")
+	ErrExpired      = errors.New("this link has expired, please sign up again")
+)
+
+// Service runs the newsletter: signups confirmed by email, post emails and
+// weekly digests. Like the Notifier every email is written to the
+// EmailDelivery table first and sent by background workers, so publishing
+// never waits on the mail server and nothing is lost on a restart.
+type Service struct {
+	DB       *gorm.DB
+	Settings *settings.Store
+	Mailer   mailer.Mailer
+
+	// MaxAttempts is how often an email is tried before it is marked failed
+	MaxAttempts int
+	// Backoff is the wait before the given retry, starting at 1
+	Backoff func(retry int) time.Duration
+	// DigestInterval is how often weekly subscribers are checked for a due digest
+	DigestInterval time.Duration
+
+	secret []byte
+	queue  chan uint
+}
+
+func New(db *gorm.DB, store *settings.Store, m mailer.Mailer, secret []byte) *Service {
+	return &Service{
+		DB:          db,
+		Settings:    store,
+		Mailer:      m,
+		MaxAttempts: 5,
+		Backoff: func(retry int) time.Duration {
+			return time.Duration(1<<(retry-1)) * time.Minute
+		},
+		DigestInterval: time.Hour,
+		secret:         secret,
+		queue:          make(chan uint, 256),
+	}
+}
+
+// Start runs the delivery workers and the digest clock, and picks up emails
+// left unsent by the previous run
+func (s *Service) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+
+	var pending []models.EmailDelivery
+	s.DB.Where("status IN ?", []string{models.EmailPending, models.EmailRetrying}).Find(&pending)
+	for _, email := range pending {
+		delay := time.Duration(0)
+		if email.NextAttemptAt != nil {
+			delay = time.Until(*email.NextAttemptAt)
+		}
+		s.schedule(email.ID, delay)
+	}
+
+	go func() {
+		for ; ; time.Sleep(s.DigestInterval) {
+			if err := s.SendDigests(); err != nil {
+				log.Printf("Failed to send digests: %v", err)
+			}
+		}
+	}()
+}
+
+// Subscribe signs address up and emails it a confirmation link. An address
+// that is already confirmed is left as it is, so that no one can change
+// another reader's subscription without access to their inbox.
+func (s *Service) Subscribe(address, frequency string) error {
+	addr, err := mail.ParseAddress(strings.TrimSpace(address))
+	if err != nil {
+		return ErrInvalidEmail
+	}
+	address = strings.ToLower(addr.Address)
+	if frequency != models.FrequencyWeekly {
+		frequency = models.FrequencyEachPost
+	}
+
+	var sub models.Subscriber
+	err = s.DB.Where("email = ?", address).First(&sub).Error
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		sub = models.Subscriber{Email: address, Status: models.SubscriberPending, Frequency: frequency}
+		if err := s.DB.Create(&sub).Error; err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case sub.Status == models.SubscriberConfirmed:
+		return nil
+	default:
+		sub.Status = models.SubscriberPending
+		sub.Frequency = frequency
+		if err := s.DB.Save(&sub).Error; err != nil {
+			return err
+		}
+	}
+
+	var recent int64
+	s.DB.Model(&models.EmailDelivery{}).
+		Where("subscriber_id = ? AND kind = ? AND created_at > ?", sub.ID, models.EmailConfirm, time.Now().Add(-confirmEvery)).
+		Count(&recent)
+	if recent > 0 {
+		return nil
+	}
+
+	site := s.Settings.Get()
+	link := site.URL(fmt.Sprintf("/newsletter/confirm?s=%d&token=%s", sub.ID, s.confirmToken(sub, time.Now().Add(confirmTTL))))
+	return s.enqueue(sub, models.EmailConfirm, nil, confirmMessage(site, sub, link))
+}
+
+// Confirm completes a signup from the link in the confirmation email
+func (s *Service) Confirm(id uint, token string) (*models.Subscriber, error) {
+	var sub models.Subscriber
+	if err := s.DB.First(&sub, id).Error; err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	ts, _, _ := strings.Cut(token, ".")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || !hmac.Equal([]byte(token), []byte(s.confirmToken(sub, time.Unix(unix, 0)))) {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() > unix {
+		return nil, ErrExpired
+	}
+
+	switch sub.Status {
+	case models.SubscriberConfirmed:
+		return &sub, nil
+	case models.SubscriberUnsubscribed:
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	sub.Status = models.SubscriberConfirmed
+	sub.ConfirmedAt = &now
+	// the first digest covers what is published from now on
+	sub.LastDigestAt = &now
+	if err := s.DB.Save(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Lookup finds the subscriber an unsubscribe link was made for
+func (s *Service) Lookup(id uint, token string) (*models.Subscriber, error) {
+	var sub models.Subscriber
+	if err := s.DB.First(&sub, id).Error; err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(token), []byte(s.unsubscribeToken(sub))) {
+		return nil, ErrInvalidToken
+	}
+	return &sub, nil
+}
+
+// Unsubscribe stops all email to the subscriber the link was made for,
+// including any still waiting to be sent
+func (s *Service) Unsubscribe(id uint, token string) (*models.Subscriber, error) {
+	sub, err := s.Lookup(id, token)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Status == models.SubscriberUnsubscribed {
+		return sub, nil
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(sub).Update("status", models.SubscriberUnsubscribed).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.EmailDelivery{}).
+			Where("subscriber_id = ? AND status IN ?", sub.ID, []string{models.EmailPending, models.EmailRetrying}).
+			Updates(map[string]any{"status": models.EmailSkipped, "next_attempt_at": nil}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Published emails a newly published post to everyone who asked for every
+// post. A subscriber is never sent the same post twice, even when it is
+// unpublished and published again.
+func (s *Service) Published(post models.Post) error {
+	if !post.Published {
+		return nil
+	}
+
+	sent := s.DB.Model(&models.EmailDelivery{}).Select("subscriber_id").
+		Where("kind = ? AND post_id = ?", models.EmailPost, post.ID)
+	var subs []models.Subscriber
+	err := s.DB.Where("status = ? AND frequency = ?", models.SubscriberConfirmed, models.FrequencyEachPost).
+		Where("id NOT IN (?)", sent).
+		Find(&subs).Error
+	if err != nil {
+		return err
+	}
+
+	site := s.Settings.Get()
+	for _, sub := range subs {
+		msg := postMessage(site, post, s.unsubscribeURL(site, sub))
+		if err := s.enqueue(sub, models.EmailPost, &post.ID, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendDigests emails each weekly subscriber whose digest is due the posts
+// published since their last one. Posts published before publication times
+// were recorded count as published when they were created.
+func (s *Service) SendDigests() error {
+	now := time.Now()
+	var subs []models.Subscriber
+	err := s.DB.Where("status = ? AND frequency = ?", models.SubscriberConfirmed, models.FrequencyWeekly).
+		Where("last_digest_at IS NULL OR last_digest_at <= ?", now.Add(-digestPeriod)).
+		Find(&subs).Error
+	if err != nil {
+		return err
+	}
+
+	site := s.Settings.Get()
+	for _, sub := range subs {
+		since := sub.CreatedAt
+		if sub.LastDigestAt != nil {
+			since = *sub.LastDigestAt
+		}
+
+		var posts []models.Post
+		err := s.DB.Where("published = ? AND COALESCE(published_at, created_at) > ?", true, since).
+			Order("COALESCE(published_at, created_at) desc").Limit(maxDigestPosts).
+			Find(&posts).Error
+		if err != nil {
+			return err
+		}
+		if len(posts) > 0 {
+			msg := digestMessage(site, posts, s.unsubscribeURL(site, sub))
+			if err := s.enqueue(sub, models.EmailDigest, nil, msg); err != nil {
+				return err
+			}
+		}
+		if err := s.DB.Model(&sub).Update("last_digest_at", now).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retry queues a failed email again with a fresh set of attempts
+func (s *Service) Retry(id uint) error {
+	result := s.DB.Model(&models.EmailDelivery{}).
+		Where("id = ? AND status = ?", id, models.EmailFailed).
+		Updates(map[string]any{"status": models.EmailPending, "attempts": 0, "next_attempt_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("email %d has not failed", id)
+	}
+	s.schedule(id, 0)
+	return nil
+}
+
+// Newsletter helpers
+
+func (s *Service) enqueue(sub models.Subscriber, kind string, postID *uint, msg mailer.Message) error {
+	email := models.EmailDelivery{
+		SubscriberID: sub.ID,
+		Kind:         kind,
+		PostID:       postID,
+		To:           sub.Email,
+		Subject:      msg.Subject,
+		Text:         msg.Text,
+		HTML:         msg.HTML,
+		Status:       models.EmailPending,
+	}
+	if kind != models.EmailConfirm {
+		email.UnsubscribeURL = s.unsubscribeURL(s.Settings.Get(), sub)
+	}
+	if err := s.DB.Create(&email).Error; err != nil {
+		return err
+	}
+	s.schedule(email.ID, 0)
+	return nil
+}
+
+func (s *Service) schedule(id uint, delay time.Duration) {
+	if delay <= 0 {
+		select {
+		case s.queue <- id:
+		default:
+			// a full queue must not block the request that published
+			go func() { s.queue <- id }()
+		}
+		return
+	}
+	time.AfterFunc(delay, func() { s.queue <- id })
+}
+
+func (s *Service) work() {
+	for id := range s.queue {
+		s.deliver(id)
+	}
+}
+
+// deliver makes one attempt and records the outcome. Rejections the server
+// calls permanent are final, anything else is retried with backoff.
+func (s *Service) deliver(id uint) {
+	var email models.EmailDelivery
+	if err := s.DB.First(&email, id).Error; err != nil {
+		return
+	}
+	if email.Status != models.EmailPending && email.Status != models.EmailRetrying {
+		return
+	}
+
+	var sub models.Subscriber
+	if err := s.DB.First(&sub, email.SubscriberID).Error; err != nil ||
+		(email.Kind != models.EmailConfirm && sub.Status != models.SubscriberConfirmed) {
+		email.Status = models.EmailSkipped
+		email.NextAttemptAt = nil
+		s.DB.Save(&email)
+		return
+	}
+
+	msg := mailer.Message{To: email.To, Subject: email.Subject, Text: email.Text, HTML: email.HTML}
+	if email.UnsubscribeURL != "" {
+		msg.Headers = map[string]string{
+			"List-Unsubscribe":      "<" + email.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+
+	err := s.Mailer.Send(msg)
+	email.Attempts++
+	email.NextAttemptAt = nil
+	email.Error = ""
+
+	var permanent *mailer.PermanentError
+	switch {
+	case err == nil:
+		now := time.Now()
+		email.Status = models.EmailSent
+		email.SentAt = &now
+	case !errors.As(err, &permanent) && email.Attempts < s.MaxAttempts:
+		next := time.Now().Add(s.Backoff(email.Attempts))
+		email.Status = models.EmailRetrying
+		email.NextAttemptAt = &next
+		email.Error = err.Error()
+	default:
+		email.Status = models.EmailFailed
+		email.Error = err.Error()
+	}
+
+	if err := s.DB.Save(&email).Error; err != nil {
+		log.Printf("Failed to record email %d: %v", email.ID, err)
+		return
+	}
+	if email.Status == models.EmailRetrying {
+		s.schedule(email.ID, time.Until(*email.NextAttemptAt))
+	}
+}
+
+func (s *Service) unsubscribeURL(site settings.Site, sub models.Subscriber) string {
+	return site.URL(fmt.Sprintf("/newsletter/unsubscribe?s=%d&token=%s", sub.ID, s.unsubscribeToken(sub)))
+}
+
+// confirmToken is the expiry followed by a signature over it and the
+// subscriber, so a link only confirms the address it was sent to
+func (s *Service) confirmToken(sub models.Subscriber, expires time.Time) string {
+	ts := strconv.FormatInt(expires.Unix(), 10)
+	return ts + "." + s.sign("newsletter-confirm:"+ts, sub)
+}
+
+// unsubscribeToken does not expire, links in old emails have to keep working
+func (s *Service) unsubscribeToken(sub models.Subscriber) string {
+	return s.sign("newsletter-unsubscribe", sub)
+}
+
+func (s *Service) sign(purpose string, sub models.Subscriber) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s:%d:%s", purpose, sub.ID, sub.Email)
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,79 @@
+package newsletter
+
+import (
+	"RustyBits/internals/mailer"
+	"RustyBits/internals/models"
+	"RustyBits/internals/settings"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBs atomic.Int64
+
+type nopMailer struct{}
+
+func (nopMailer) Send(mailer.Message) error { return nil }
+
+// digests pick posts by when they were published, so a draft written before
+// the last digest and published after it is in the next one
+func TestDigestPostsByPublication(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:newsletter%d?mode=memory&cache=shared", testDBs.Add(1))), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Setting{}, &models.Post{}, &models.Subscriber{}, &models.EmailDelivery{}); err != nil {
+		t.Fatal(err)
+	}
+	store, err := settings.NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(db, store, nopMailer{}, []byte("secret"))
+
+	now := time.Now()
+	lastDigest := now.Add(-8 * 24 * time.Hour)
+	days := func(n int) *time.Time {
+		t := now.Add(time.Duration(n) * 24 * time.Hour)
+		return &t
+	}
+	posts := []models.Post{
+		{Title: "Old draft, published since", Slug: "old-draft", CreatedAt: *days(-30), PublishedAt: days(-1)},
+		{Title: "Published before the last digest", Slug: "old", CreatedAt: *days(-10), PublishedAt: days(-9)},
+		{Title: "Published before times were recorded", Slug: "legacy", CreatedAt: *days(-2)},
+		{Title: "Legacy and old", Slug: "legacy-old", CreatedAt: *days(-20)},
+	}
+	for _, post := range posts {
+		post.Published = true
+		if err := db.Create(&post).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := models.Subscriber{Email: "weekly@example.com", Status: models.SubscriberConfirmed, Frequency: models.FrequencyWeekly, LastDigestAt: &lastDigest}
+	if err := db.Create(&sub).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SendDigests(); err != nil {
+		t.Fatal(err)
+	}
+
+	var digest models.EmailDelivery
+	if err := db.Where("kind = ?", models.EmailDigest).First(&digest).Error; err != nil {
+		t.Fatalf("no digest queued: %v", err)
+	}
+	for _, post := range posts {
+		want := post.Slug == "old-draft" || post.Slug == "legacy"
+		if got := strings.Contains(digest.Text, post.Title); got != want {
+			t.Errorf("digest lists %q: %v, want %v", post.Title, got, want)
+		}
+	}
+}
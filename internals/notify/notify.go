@@ -0,0 +1,302 @@
+package notify
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/settings"
+	"RustyBits/internals/webmention"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ping kinds
+const (
+	KindWebSub     = "websub"
+	KindIndexNow   = "indexnow"
+	KindWebmention = "webmention"
+	KindActivity   = "activitypub"
+)
+
+// KeyPath is where the IndexNow key file is served, proving we own the host
+const KeyPath = "/indexnow-key.txt"
+
+// Notifier tells hubs, search engines, linked sites and fediverse followers
+// about newly published content. Every ping is written to the PingLog table
+// first and delivered by background workers, so publishing never waits on a
+// third party and pings survive a restart.
+type Notifier struct {
+	DB       *gorm.DB
+	Settings *settings.Store
+	Client   *http.Client
+	// UntrustedClient is used for urls anyone could have supplied: pages
+	// linked from posts and the inboxes of fediverse followers
+	UntrustedClient *http.Client
+	// SignActivity signs ActivityPub deliveries with the blog's actor key
+	SignActivity func(req *http.Request, body []byte) error
+
+	// MaxAttempts is how often a ping is tried before it is marked failed
+	MaxAttempts int
+	// Backoff is the wait before the given retry, starting at 1
+	Backoff func(retry int) time.Duration
+
+	queue chan uint
+}
+
+func New(db *gorm.DB, store *settings.Store) *Notifier {
+	return &Notifier{
+		DB:              db,
+		Settings:        store,
+		Client:          &http.Client{Timeout: 15 * time.Second},
+		UntrustedClient: webmention.SafeClient(15 * time.Second),
+		MaxAttempts:     5,
+		Backoff: func(retry int) time.Duration {
+			return time.Duration(1<<(retry-1)) * 30 * time.Second
+		},
+		queue: make(chan uint, 256),
+	}
+}
+
+// Start runs the delivery workers and picks up pings left unfinished by the
+// previous run
+func (n *Notifier) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go n.work()
+	}
+
+	var pending []models.PingLog
+	n.DB.Where("status IN ?", []string{models.PingPending, models.PingRetrying}).Find(&pending)
+	for _, ping := range pending {
+		delay := time.Duration(0)
+		if ping.NextAttemptAt != nil {
+			delay = time.Until(*ping.NextAttemptAt)
+		}
+		n.schedule(ping.ID, delay)
+	}
+}
+
+// Published queues the pings for newly public content: a WebSub publish of
+// every feed that changed, and an IndexNow submission of the page urls
+func (n *Notifier) Published(pageURLs, feedURLs []string) error {
+	site := n.Settings.Get()
+	var pings []models.PingLog
+
+	if site.WebSubHub != "" && len(feedURLs) > 0 {
+		form := url.Values{}
+		form.Set("hub.mode", "publish")
+		for _, topic := range feedURLs {
+			form.Add("hub.url", topic)
+		}
+		pings = append(pings, models.PingLog{
+			Kind:        KindWebSub,
+			Endpoint:    site.WebSubHub,
+			ContentType: "application/x-www-form-urlencoded",
+			Payload:     form.Encode(),
+		})
+	}
+
+	if site.IndexNowKey != "" && len(pageURLs) > 0 {
+		base, err := url.Parse(site.BaseURL)
+		if err != nil {
+			return fmt.Errorf("indexnow needs a valid base url: %w", err)
+		}
+		body, err := json.Marshal(map[string]any{
+			"host":        base.Host,
+			"key":         site.IndexNowKey,
+			"keyLocation": site.URL(KeyPath),
+			"urlList":     pageURLs,
+		})
+		if err != nil {
+			return err
+		}
+		for _, endpoint := range site.IndexNowEndpointList() {
+			pings = append(pings, models.PingLog{
+				Kind:        KindIndexNow,
+				Endpoint:    endpoint,
+				ContentType: "application/json; charset=utf-8",
+				Payload:     string(body),
+			})
+		}
+	}
+
+	return n.queuePings(pings)
+}
+
+// Mention queues a webmention from source to each target. The endpoint of a
+// target is only discovered when the ping is delivered, so the ping's
+// endpoint is the target page itself.
+func (n *Notifier) Mention(source string, targets []string) error {
+	var pings []models.PingLog
+	for _, target := range targets {
+		form := url.Values{"source": {source}, "target": {target}}
+		pings = append(pings, models.PingLog{
+			Kind:        KindWebmention,
+			Endpoint:    target,
+			ContentType: "application/x-www-form-urlencoded",
+			Payload:     form.Encode(),
+		})
+	}
+	return n.queuePings(pings)
+}
+
+// Deliver queues an ActivityPub activity for each inbox. It is signed when it
+// is sent, so a retry carries a fresh date.
+func (n *Notifier) Deliver(inboxes []string, activity []byte) error {
+	var pings []models.PingLog
+	for _, inbox := range inboxes {
+		pings = append(pings, models.PingLog{
+			Kind:        KindActivity,
+			Endpoint:    inbox,
+			ContentType: "application/activity+json",
+			Payload:     string(activity),
+		})
+	}
+	return n.queuePings(pings)
+}
+
+// Retry queues a failed ping again with a fresh set of attempts
+func (n *Notifier) Retry(id uint) error {
+	result := n.DB.Model(&models.PingLog{}).
+		Where("id = ? AND status = ?", id, models.PingFailed).
+		Updates(map[string]any{"status": models.PingPending, "attempts": 0, "next_attempt_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("ping %d has not failed", id)
+	}
+	n.schedule(id, 0)
+	return nil
+}
+
+// Notifier helpers
+
+func (n *Notifier) queuePings(pings []models.PingLog) error {
+	for i := range pings {
+		pings[i].Status = models.PingPending
+		if err := n.DB.Create(&pings[i]).Error; err != nil {
+			return err
+		}
+		n.schedule(pings[i].ID, 0)
+	}
+	return nil
+}
+
+func (n *Notifier) schedule(id uint, delay time.Duration) {
+	if delay <= 0 {
+		select {
+		case n.queue <- id:
+		default:
+			// a full queue must not block the request that published
+			go func() { n.queue <- id }()
+		}
+		return
+	}
+	time.AfterFunc(delay, func() { n.queue <- id })
+}
+
+func (n *Notifier) work() {
+	for id := range n.queue {
+		n.deliver(id)
+	}
+}
+
+// deliver makes one attempt and records the outcome. Network errors, 429
+// and 5xx responses are retried with backoff, anything else is final.
+func (n *Notifier) deliver(id uint) {
+	var ping models.PingLog
+	if err := n.DB.First(&ping, id).Error; err != nil {
+		return
+	}
+	if ping.Status != models.PingPending && ping.Status != models.PingRetrying {
+		return
+	}
+
+	code, err := n.send(ping)
+	ping.Attempts++
+	ping.ResponseCode = code
+	ping.NextAttemptAt = nil
+	ping.Error = ""
+
+	switch {
+	case err == nil:
+		ping.Status = models.PingSent
+	case errors.Is(err, webmention.ErrNoEndpoint):
+		ping.Status = models.PingSkipped
+		ping.Error = err.Error()
+	case retryable(code) && ping.Attempts < n.MaxAttempts && !errors.Is(err, webmention.ErrUnsafeAddress):
+		next := time.Now().Add(n.Backoff(ping.Attempts))
+		ping.Status = models.PingRetrying
+		ping.NextAttemptAt = &next
+		ping.Error = err.Error()
+	default:
+		ping.Status = models.PingFailed
+		ping.Error = err.Error()
+	}
+
+	if err := n.DB.Save(&ping).Error; err != nil {
+		log.Printf("Failed to record ping %d: %v", ping.ID, err)
+		return
+	}
+	if ping.Status == models.PingRetrying {
+		n.schedule(ping.ID, time.Until(*ping.NextAttemptAt))
+	}
+}
+
+func (n *Notifier) send(ping models.PingLog) (int, error) {
+	client, endpoint := n.Client, ping.Endpoint
+	if ping.Kind == KindWebmention {
+		client = n.UntrustedClient
+		discovered, err := webmention.Discover(client, ping.Endpoint)
+		if err != nil {
+			var status *webmention.StatusError
+			if errors.As(err, &status) {
+				return status.Code, err
+			}
+			return 0, err
+		}
+		endpoint = discovered
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBufferString(ping.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", ping.ContentType)
+	req.Header.Set("User-Agent", "RustyBits")
+	if ping.Kind == KindActivity {
+		client = n.UntrustedClient
+		if n.SignActivity == nil {
+			return 0, errors.New("no key to sign activities with")
+		}
+		if err := n.SignActivity(req, []byte(ping.Payload)); err != nil {
+			return 0, err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether a failure may go away on its own. Code 0 means
+// the request never got a response.
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,330 @@
+package notify
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/settings"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testDBs atomic.Int64
+
+// endpoint answers with the given statuses in turn, repeating the last one,
+// and records what it was sent
+type endpoint struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []request
+}
+
+type request struct {
+	ContentType string
+	Body        string
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = append(e.requests, request{ContentType: r.Header.Get("Content-Type"), Body: string(body)})
+
+	status := e.statuses[0]
+	if len(e.statuses) > 1 {
+		e.statuses = e.statuses[1:]
+	}
+	w.WriteHeader(status)
+	fmt.Fprint(w, http.StatusText(status))
+}
+
+type fixture struct {
+	notifier *Notifier
+	db       *gorm.DB
+	server   *httptest.Server
+	// backoffs are the retry numbers Backoff was asked about
+	backoffs []int
+
+	hub, indexNow, webmention *endpoint
+}
+
+// newFixture points every kind of ping at one test server: the WebSub hub at
+// /hub, IndexNow at /indexnow, and a page at /page whose Link header names
+// /webmention as its endpoint. /plain is a page without an endpoint.
+func newFixture(t *testing.T, hub, indexNow, webmention []int) *fixture {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:notify%d?mode=memory&cache=shared", testDBs.Add(1))), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Setting{}, &models.PingLog{}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{
+		db:         db,
+		hub:        &endpoint{statuses: hub},
+		indexNow:   &endpoint{statuses: indexNow},
+		webmention: &endpoint{statuses: webmention},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/hub", f.hub)
+	mux.Handle("/indexnow", f.indexNow)
+	mux.Handle("/webmention", f.webmention)
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</webmention>; rel="webmention"`)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>linked</body></html>")
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>no endpoint</body></html>")
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	store, err := settings.NewStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := settings.Defaults()
+	site.BaseURL = "https://blog.example"
+	site.WebSubHub = f.server.URL + "/hub"
+	site.IndexNowKey = "abcdef123456"
+	site.IndexNowEndpoints = f.server.URL + "/indexnow"
+	if err := store.Update(site); err != nil {
+		t.Fatal(err)
+	}
+
+	f.notifier = New(db, store)
+	// the test server is on loopback, which the real untrusted client refuses
+	f.notifier.UntrustedClient = f.server.Client()
+	f.notifier.MaxAttempts = 3
+	f.notifier.Backoff = func(retry int) time.Duration {
+		f.backoffs = append(f.backoffs, retry)
+		return time.Hour
+	}
+	return f
+}
+
+// deliverAll makes one attempt at every ping still due, as a worker would
+func (f *fixture) deliverAll(t *testing.T) []models.PingLog {
+	t.Helper()
+	var due []models.PingLog
+	f.db.Where("status IN ?", []string{models.PingPending, models.PingRetrying}).Find(&due)
+	for _, ping := range due {
+		f.notifier.deliver(ping.ID)
+	}
+
+	var pings []models.PingLog
+	f.db.Order("id").Find(&pings)
+	return pings
+}
+
+func TestPublishedPayloads(t *testing.T) {
+	f := newFixture(t, []int{http.StatusNoContent}, []int{http.StatusOK}, []int{http.StatusAccepted})
+
+	feeds := []string{"https://blog.example/feed.xml", "https://blog.example/feed.json"}
+	if err := f.notifier.Published([]string{"https://blog.example/posts/hello"}, feeds); err != nil {
+		t.Fatal(err)
+	}
+	for _, ping := range f.deliverAll(t) {
+		if ping.Status != models.PingSent || ping.Attempts != 1 {
+			t.Errorf("%s ping: status %s after %d attempts", ping.Kind, ping.Status, ping.Attempts)
+		}
+	}
+
+	if len(f.hub.requests) != 1 {
+		t.Fatalf("hub got %d requests", len(f.hub.requests))
+	}
+	form, _ := url.ParseQuery(f.hub.requests[0].Body)
+	if form.Get("hub.mode") != "publish" || len(form["hub.url"]) != 2 || form["hub.url"][1] != feeds[1] {
+		t.Errorf("websub publish = %v", form)
+	}
+
+	if len(f.indexNow.requests) != 1 {
+		t.Fatalf("indexnow got %d requests", len(f.indexNow.requests))
+	}
+	var submission struct {
+		Host        string   `json:"host"`
+		Key         string   `json:"key"`
+		KeyLocation string   `json:"keyLocation"`
+		URLList     []string `json:"urlList"`
+	}
+	if err := json.Unmarshal([]byte(f.indexNow.requests[0].Body), &submission); err != nil {
+		t.Fatal(err)
+	}
+	if submission.Host != "blog.example" || submission.Key != "abcdef123456" ||
+		submission.KeyLocation != "https://blog.example"+KeyPath || len(submission.URLList) != 1 {
+		t.Errorf("indexnow submission = %+v", submission)
+	}
+}
+
+func TestDeliveryOutcomes(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		// want is the status after each attempt
+		want     []string
+		backoffs int
+	}{
+		{"success", []int{http.StatusOK}, []string{models.PingSent}, 0},
+		{"retryable 5xx", []int{http.StatusServiceUnavailable, http.StatusOK}, []string{models.PingRetrying, models.PingSent}, 1},
+		{"retries run out", []int{http.StatusBadGateway}, []string{models.PingRetrying, models.PingRetrying, models.PingFailed}, 2},
+		{"rate limited", []int{http.StatusTooManyRequests, http.StatusOK}, []string{models.PingRetrying, models.PingSent}, 1},
+		{"terminal 4xx", []int{http.StatusBadRequest}, []string{models.PingFailed}, 0},
+	}
+
+	kinds := []struct {
+		kind  string
+		queue func(f *fixture) error
+	}{
+		{KindWebSub, func(f *fixture) error {
+			return f.notifier.Published(nil, []string{"https://blog.example/feed.xml"})
+		}},
+		{KindIndexNow, func(f *fixture) error {
+			return f.notifier.Published([]string{"https://blog.example/posts/hello"}, nil)
+		}},
+		{KindWebmention, func(f *fixture) error {
+			return f.notifier.Mention("https://blog.example/posts/hello", []string{f.server.URL + "/page"})
+		}},
+	}
+
+	for _, kind := range kinds {
+		for _, tt := range tests {
+			t.Run(kind.kind+"/"+tt.name, func(t *testing.T) {
+				f := newFixture(t, tt.statuses, tt.statuses, tt.statuses)
+				if err := kind.queue(f); err != nil {
+					t.Fatal(err)
+				}
+
+				for attempt, want := range tt.want {
+					pings := f.deliverAll(t)
+					if len(pings) != 1 {
+						t.Fatalf("queued %d pings, want 1", len(pings))
+					}
+					ping := pings[0]
+					if ping.Kind != kind.kind {
+						t.Fatalf("queued a %s ping", ping.Kind)
+					}
+					if ping.Status != want || ping.Attempts != attempt+1 {
+						t.Fatalf("after attempt %d: status %s with %d attempts, want %s", attempt+1, ping.Status, ping.Attempts, want)
+					}
+					if ping.ResponseCode != tt.statuses[min(attempt, len(tt.statuses)-1)] {
+						t.Errorf("after attempt %d: response code %d", attempt+1, ping.ResponseCode)
+					}
+
+					switch want {
+					case models.PingRetrying:
+						if ping.NextAttemptAt == nil || time.Until(*ping.NextAttemptAt) < 59*time.Minute {
+							t.Errorf("retry scheduled at %v, want an hour from now", ping.NextAttemptAt)
+						}
+						if ping.Error == "" {
+							t.Error("retrying ping has no error")
+						}
+					case models.PingSent:
+						if ping.NextAttemptAt != nil || ping.Error != "" {
+							t.Errorf("sent ping kept next attempt %v and error %q", ping.NextAttemptAt, ping.Error)
+						}
+					case models.PingFailed:
+						if ping.NextAttemptAt != nil || ping.Error == "" {
+							t.Errorf("failed ping has next attempt %v and error %q", ping.NextAttemptAt, ping.Error)
+						}
+					}
+				}
+
+				if len(f.backoffs) != tt.backoffs {
+					t.Errorf("backed off %d times, want %d", len(f.backoffs), tt.backoffs)
+				}
+				for i, retry := range f.backoffs {
+					if retry != i+1 {
+						t.Errorf("backoff %d was asked about retry %d", i, retry)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestWebmentionDelivery(t *testing.T) {
+	f := newFixture(t, []int{http.StatusOK}, []int{http.StatusOK}, []int{http.StatusCreated})
+
+	source := "https://blog.example/posts/hello"
+	if err := f.notifier.Mention(source, []string{f.server.URL + "/page", f.server.URL + "/plain"}); err != nil {
+		t.Fatal(err)
+	}
+	pings := f.deliverAll(t)
+
+	if pings[0].Status != models.PingSent {
+		t.Errorf("mention of a page with an endpoint: %s (%s)", pings[0].Status, pings[0].Error)
+	}
+	if len(f.webmention.requests) != 1 {
+		t.Fatalf("endpoint got %d requests", len(f.webmention.requests))
+	}
+	sent := f.webmention.requests[0]
+	form, _ := url.ParseQuery(sent.Body)
+	if sent.ContentType != "application/x-www-form-urlencoded" || form.Get("source") != source || form.Get("target") != f.server.URL+"/page" {
+		t.Errorf("webmention sent %s %q", sent.ContentType, sent.Body)
+	}
+
+	if pings[1].Status != models.PingSkipped || pings[1].Attempts != 1 {
+		t.Errorf("mention of a page without an endpoint: %s after %d attempts", pings[1].Status, pings[1].Attempts)
+	}
+}
+
+func TestWebmentionRefusesPrivateAddresses(t *testing.T) {
+	f := newFixture(t, []int{http.StatusOK}, []int{http.StatusOK}, []int{http.StatusOK})
+	f.notifier.UntrustedClient = New(f.db, f.notifier.Settings).UntrustedClient
+
+	if err := f.notifier.Mention("https://blog.example/posts/hello", []string{f.server.URL + "/page"}); err != nil {
+		t.Fatal(err)
+	}
+	ping := f.deliverAll(t)[0]
+
+	// an unsafe address will not become safe, so it is not retried
+	if ping.Status != models.PingFailed || len(f.backoffs) != 0 {
+		t.Errorf("ping to loopback: %s after %d backoffs", ping.Status, len(f.backoffs))
+	}
+	if len(f.webmention.requests) != 0 {
+		t.Error("the private endpoint was contacted")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	f := newFixture(t, []int{http.StatusBadRequest, http.StatusOK}, []int{http.StatusOK}, []int{http.StatusOK})
+	if err := f.notifier.Published(nil, []string{"https://blog.example/feed.xml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ping := f.deliverAll(t)[0]
+	if ping.Status != models.PingFailed {
+		t.Fatalf("status %s, want failed", ping.Status)
+	}
+	if err := f.notifier.Retry(ping.ID); err != nil {
+		t.Fatal(err)
+	}
+	f.db.First(&ping, ping.ID)
+	if ping.Status != models.PingPending || ping.Attempts != 0 {
+		t.Fatalf("retried ping: status %s with %d attempts", ping.Status, ping.Attempts)
+	}
+
+	ping = f.deliverAll(t)[0]
+	if ping.Status != models.PingSent {
+		t.Errorf("status %s after the retry, want sent", ping.Status)
+	}
+	if err := f.notifier.Retry(ping.ID); err == nil {
+		t.Error("a sent ping was retried")
+	}
+}
@@ -0,0 +1,221 @@
+package ogimage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Width and Height are the card size recommended by Open Graph consumers
+const (
+	Width  = 1200
+	Height = 630
+)
+
+const (
+	margin       = 80
+	titleLines   = 4
+	maxTitleSize = 72
+	minTitleSize = 44
+	metaSize     = 30
+	tagSize      = 28
+	maxTags      = 5
+)
+
+var (
+	background = color.RGBA{0x1b, 0x1f, 0x2a, 0xff}
+	accent     = color.RGBA{0xe0, 0x6c, 0x3c, 0xff}
+	foreground = color.RGBA{0xf5, 0xf3, 0xee, 0xff}
+	muted      = color.RGBA{0xa8, 0xad, 0xba, 0xff}
+)
+
+// Card is what goes on a social preview image
+type Card struct {
+	Title    string
+	Tags     []string
+	SiteName string
+	Date     time.Time
+}
+
+var (
+	loadFonts sync.Once
+	boldFont  *opentype.Font
+	textFont  *opentype.Font
+	fontErr   error
+)
+
+// fonts parses the embedded Go fonts once. Fonts are safe to share, faces are
+// not, so every render creates its own.
+func fonts() (*opentype.Font, *opentype.Font, error) {
+	loadFonts.Do(func() {
+		if boldFont, fontErr = opentype.Parse(gobold.TTF); fontErr != nil {
+			return
+		}
+		textFont, fontErr = opentype.Parse(goregular.TTF)
+	})
+	return boldFont, textFont, fontErr
+}
+
+// Render draws the card as a PNG: the title wrapped over up to four lines,
+// the tags below it and the site name and date along the bottom
+func Render(card Card) ([]byte, error) {
+	bold, regular, err := fonts()
+	if err != nil {
+		return nil, fmt.Errorf("load fonts: %w", err)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 16, Height), image.NewUniform(accent), image.Point{}, draw.Src)
+
+	textWidth := Width - 2*margin
+
+	// shrink the title until it fits, truncating it at the smallest size
+	var titleFace font.Face
+	var lines []string
+	for size := maxTitleSize; size >= minTitleSize; size -= 4 {
+		if titleFace != nil {
+			titleFace.Close()
+		}
+		if titleFace, err = newFace(bold, float64(size)); err != nil {
+			return nil, err
+		}
+		lines = wrap(titleFace, card.Title, textWidth)
+		if len(lines) <= titleLines {
+			break
+		}
+	}
+	defer titleFace.Close()
+
+	if len(lines) > titleLines {
+		lines = lines[:titleLines]
+		lines[titleLines-1] = truncate(titleFace, lines[titleLines-1]+"…", textWidth)
+	}
+
+	lineHeight := titleFace.Metrics().Height.Ceil() * 6 / 5
+	y := margin + titleFace.Metrics().Ascent.Ceil()
+	for _, line := range lines {
+		drawText(img, titleFace, foreground, margin, y, line)
+		y += lineHeight
+	}
+
+	if len(card.Tags) > 0 {
+		tagFace, err := newFace(regular, tagSize)
+		if err != nil {
+			return nil, err
+		}
+		defer tagFace.Close()
+
+		tags := card.Tags
+		if len(tags) > maxTags {
+			tags = tags[:maxTags]
+		}
+		labels := make([]string, len(tags))
+		for i, tag := range tags {
+			labels[i] = "#" + tag
+		}
+		drawText(img, tagFace, accent, margin, y+tagSize/2, truncate(tagFace, strings.Join(labels, "  "), textWidth))
+	}
+
+	metaFace, err := newFace(bold, metaSize)
+	if err != nil {
+		return nil, err
+	}
+	defer metaFace.Close()
+
+	baseline := Height - margin
+	drawText(img, metaFace, foreground, margin, baseline, truncate(metaFace, card.SiteName, textWidth*2/3))
+	if !card.Date.IsZero() {
+		date := card.Date.Format("January 2, 2006")
+		width := font.MeasureString(metaFace, date).Ceil()
+		drawText(img, metaFace, muted, Width-margin-width, baseline, date)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode card: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func newFace(f *opentype.Font, size float64) (font.Face, error) {
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+func drawText(dst draw.Image, face font.Face, c color.Color, x, y int, text string) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// wrap breaks text into lines no wider than width, splitting words that are
+// too long for a line of their own
+func wrap(face font.Face, text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if font.MeasureString(face, candidate).Ceil() <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		for font.MeasureString(face, word).Ceil() > width {
+			head := fit(face, word, width)
+			lines = append(lines, head)
+			word = word[len(head):]
+		}
+		line = word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncate shortens text with an ellipsis until it fits in width
+func truncate(face font.Face, text string, width int) string {
+	if font.MeasureString(face, text).Ceil() <= width {
+		return text
+	}
+	text = strings.TrimSuffix(text, "…")
+	return strings.TrimRight(fit(face, text, width-font.MeasureString(face, "…").Ceil()), " ") + "…"
+}
+
+// fit is the longest prefix of text, at least one rune, that fits in width
+func fit(face font.Face, text string, width int) string {
+	end := 0
+	for i, r := range text {
+		next := i + len(string(r))
+		if end > 0 && font.MeasureString(face, text[:next]).Ceil() > width {
+			break
+		}
+		end = next
+	}
+	return text[:end]
+}
@@ -0,0 +1,176 @@
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Form fields a solved challenge is submitted in
+const (
+	ChallengeField = "pow_challenge"
+	SolutionField  = "pow_solution"
+)
+
+// challengeTTL is how long a challenge can be solved and submitted
+const challengeTTL = 10 * time.Minute
+
+// maxSolutionLength keeps clients from making us hash arbitrary amounts of data
+const maxSolutionLength = 20
+
+// Script solves challenges in the browser for forms marked with data-pow
+//
+//go:embed solver.js
+var Script []byte
+
+var (
+	ErrMissing = errors.New("proof of work is missing")
+	ErrInvalid = errors.New("proof of work is invalid")
+	ErrExpired = errors.New("proof of work has expired, please try again")
+	ErrReused  = errors.New("proof of work was already used")
+)
+
+// Challenge is handed to the client. The solution is a decimal number n such
+// that sha256(Token + ":" + n) starts with Difficulty zero bits.
+type Challenge struct {
+	Token      string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+	Expires    int64  `json:"expires"`
+}
+
+// Verifier issues signed challenges and checks their solutions. Challenges
+// are stateless until solved, after which they are remembered until they
+// expire so a solution cannot be replayed.
+type Verifier struct {
+	secret     []byte
+	difficulty func() int
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// New returns a verifier signing with secret. difficulty is read for every
+// challenge, so changing the setting applies right away; 0 turns the check off.
+func New(secret []byte, difficulty func() int) *Verifier {
+	return &Verifier{
+		secret:     secret,
+		difficulty: difficulty,
+		used:       make(map[string]time.Time),
+	}
+}
+
+// Enabled reports whether solutions are currently required
+func (v *Verifier) Enabled() bool {
+	return v.difficulty() > 0
+}
+
+func (v *Verifier) Issue() (Challenge, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, err
+	}
+
+	difficulty := v.difficulty()
+	expires := time.Now().Add(challengeTTL).Unix()
+	payload := fmt.Sprintf("%s.%d.%d", hex.EncodeToString(nonce), expires, difficulty)
+
+	return Challenge{
+		Token:      payload + "." + v.sign(payload),
+		Difficulty: difficulty,
+		Expires:    expires,
+	}, nil
+}
+
+// Verify checks that solution solves the challenge token, which must be one
+// we issued, unexpired and not used before
+func (v *Verifier) Verify(token, solution string) error {
+	if token == "" || solution == "" {
+		return ErrMissing
+	}
+
+	payload, sig, ok := cutLast(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(v.sign(payload))) {
+		return ErrInvalid
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return ErrInvalid
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ErrInvalid
+	}
+	if time.Now().Unix() > expires {
+		return ErrExpired
+	}
+
+	if len(solution) > maxSolutionLength {
+		return ErrInvalid
+	}
+	if _, err := strconv.ParseUint(solution, 10, 64); err != nil {
+		return ErrInvalid
+	}
+	if LeadingZeroBits(sha256.Sum256([]byte(token+":"+solution))) < difficulty {
+		return ErrInvalid
+	}
+
+	return v.markUsed(parts[0], time.Unix(expires, 0))
+}
+
+// LeadingZeroBits counts the zero bits a digest starts with
+func LeadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// Verifier helpers
+
+func (v *Verifier) markUsed(nonce string, expires time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	for n, exp := range v.used {
+		if now.After(exp) {
+			delete(v.used, n)
+		}
+	}
+
+	if _, seen := v.used[nonce]; seen {
+		return ErrReused
+	}
+	v.used[nonce] = expires
+	return nil
+}
+
+func (v *Verifier) sign(payload string) string {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte("pow:" + payload))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,90 @@
+// Solves the proof of work challenge for forms marked with data-pow. Solving
+// starts when someone focuses the form and the form is sent once it is done.
+(function () {
+  "use strict";
+
+  var encoder = new TextEncoder();
+
+  function leadingZeroBits(bytes) {
+    var n = 0;
+    for (var i = 0; i < bytes.length; i++) {
+      if (bytes[i] === 0) {
+        n += 8;
+        continue;
+      }
+      return n + Math.clz32(bytes[i]) - 24;
+    }
+    return n;
+  }
+
+  async function solve(challenge, difficulty) {
+    for (var n = 0; ; n++) {
+      var digest = await crypto.subtle.digest("SHA-256", encoder.encode(challenge + ":" + n));
+      if (leadingZeroBits(new Uint8Array(digest)) >= difficulty) {
+        return String(n);
+      }
+    }
+  }
+
+  function field(form, name) {
+    var input = form.querySelector('input[name="' + name + '"]');
+    if (!input) {
+      input = document.createElement("input");
+      input.type = "hidden";
+      input.name = name;
+      form.appendChild(input);
+    }
+    return input;
+  }
+
+  function prepare(form) {
+    if (!form._pow) {
+      form._pow = fetch("/pow/challenge", { cache: "no-store" })
+        .then(function (response) {
+          if (!response.ok) throw new Error("challenge request failed");
+          return response.json();
+        })
+        .then(function (challenge) {
+          if (challenge.difficulty === 0) return;
+          return solve(challenge.challenge, challenge.difficulty).then(function (solution) {
+            field(form, "pow_challenge").value = challenge.challenge;
+            field(form, "pow_solution").value = solution;
+          });
+        })
+        // send the form anyway, the server explains what went wrong
+        .catch(function () {});
+    }
+    return form._pow;
+  }
+
+  function powForm(target) {
+    return target && target.closest ? target.closest("form[data-pow]") : null;
+  }
+
+  document.addEventListener("focusin", function (event) {
+    var form = powForm(event.target);
+    if (form) prepare(form);
+  });
+
+  // plain forms are held back until solved, then submitted again
+  document.addEventListener("submit", function (event) {
+    var form = powForm(event.target);
+    if (!form || form.hasAttribute("hx-post") || form.dataset.powReady) return;
+    event.preventDefault();
+    prepare(form).then(function () {
+      form.dataset.powReady = "1";
+      form.requestSubmit();
+    });
+  }, true);
+
+  // HTMX forms wait the same way, and get a fresh challenge for the next request
+  document.addEventListener("htmx:confirm", function (event) {
+    var form = powForm(event.target);
+    if (!form) return;
+    event.preventDefault();
+    prepare(form).then(function () {
+      form._pow = null;
+      event.detail.issueRequest();
+    });
+  });
+})();
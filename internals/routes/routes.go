@@ -3,6 +3,7 @@ package routes
 import (
 	"RustyBits/internals/handlers"
 	"RustyBits/internals/middleware"
+	"RustyBits/internals/notify"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -17,9 +18,54 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB) {
 	// Public routes
 	r.GET("/", h.Home)
 	r.GET("/posts/:slug", h.GetPost)
+	r.GET("/posts/:slug/og.png", h.PostOGImage)
+	r.GET("/posts/:slug/comments", h.GetComments)
+	r.POST("/posts/:slug/comments", middleware.ProofOfWork(h.PoW, h.RejectComment), h.CreateComment)
 	r.GET("/posts", h.GetPosts)
 	r.GET("/tags/:tag", h.GetPostsByTag)
+	r.GET("/tags/:tag/feed", h.TagFeed)
+	r.GET("/authors/:id/feed", h.AuthorFeed)
+	r.GET("/categories", h.GetCategories)
+	r.GET("/categories/:slug", h.GetPostsByCategory)
+	r.GET("/categories/:slug/rss", h.CategoryRSS)
+	r.GET("/series", h.GetSeriesList)
+	r.GET("/series/:slug", h.GetSeries)
 	r.GET("/rss", h.RSS)
+	r.GET("/feed", h.Feed)
+	r.GET("/sitemap.xml", h.Sitemap)
+	r.GET("/sitemaps/:name", h.SitemapFile)
+	r.GET("/robots.txt", h.Robots)
+	r.GET(notify.KeyPath, h.IndexNowKey)
+	r.GET("/pow/challenge", h.PowChallenge)
+	r.GET("/pow.js", h.PowScript)
+	r.POST("/webmention", h.ReceiveWebmention)
+	r.GET("/media/signed/*key", h.ServeSignedMedia)
+
+	r.GET("/contact", h.ContactForm)
+	r.POST("/contact", middleware.ProofOfWork(h.PoW, h.RejectContact), h.SendContact)
+
+	r.GET("/newsletter", h.NewsletterForm)
+	r.POST("/newsletter", middleware.ProofOfWork(h.PoW, h.RejectSubscribe), h.Subscribe)
+	r.GET("/newsletter/confirm", h.ConfirmSubscription)
+	r.GET("/newsletter/unsubscribe", h.UnsubscribeForm)
+	r.POST("/newsletter/unsubscribe", h.Unsubscribe)
+
+	r.GET("/.well-known/webfinger", h.WebFinger)
+	ap := r.Group("/ap")
+	{
+		ap.GET("/actor", h.Actor)
+		ap.POST("/inbox", h.Inbox)
+		ap.GET("/outbox", h.Outbox)
+		ap.GET("/followers", h.Followers)
+	}
+
+	micropub := r.Group("/micropub")
+	micropub.Use(middleware.TokenRequired(db))
+	{
+		micropub.GET("", h.MicropubQuery)
+		micropub.POST("", h.Micropub)
+		micropub.POST("/media", h.MicropubMedia)
+	}
 
 	//  routes for HTMX
 	api := r.Group("/api")
@@ -29,7 +75,8 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB) {
 	}
 
 	r.GET("/login", h.LoginForm)
-	r.POST("/login", h.Login)
+	// should a solver ever fail, pow_difficulty = 0 turns the check off
+	r.POST("/login", middleware.ProofOfWork(h.PoW, h.RejectLogin), h.Login)
 	r.POST("/logout", h.Logout)
 
 	admin := r.Group("/admin")
@@ -43,7 +90,82 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB) {
 		admin.PATCH("/posts/:id", h.UpodatePost)
 		admin.DELETE("/posts/:id", h.DeletePost)
 		admin.PATCH("/posts/:id/toggle", h.TogglePublished)
+		admin.PATCH("/posts/:id/comments", h.ToggleComments)
+
+		admin.GET("/comments", h.AdminComments)
+		admin.POST("/comments/bulk", h.BulkComments)
+		admin.DELETE("/comments/:id", h.DeleteComment)
+
+		admin.GET("/categories", h.AdminCategories)
+		admin.POST("/categories", h.CreateCategory)
+		admin.PATCH("/categories/:id", h.UpdateCategory)
+		admin.DELETE("/categories/:id", h.DeleteCategory)
+
+		admin.GET("/series", h.AdminSeries)
+		admin.POST("/series", h.CreateSeries)
+		admin.PATCH("/series/:id", h.UpdateSeries)
+		admin.DELETE("/series/:id", h.DeleteSeries)
+
+		admin.GET("/pages", h.AdminPages)
+		admin.GET("/pages/new", h.NewPageForm)
+		admin.POST("/pages", h.CreatePage)
+		admin.POST("/pages/reorder", h.ReorderPages)
+		admin.GET("/pages/:id/edit", h.EditPageForm)
+		admin.PATCH("/pages/:id", h.UpdatePage)
+		admin.DELETE("/pages/:id", h.DeletePage)
+
+		admin.GET("/settings", h.AdminSettings)
+		admin.POST("/settings", h.UpdateSettings)
+
+		admin.GET("/pings", h.AdminPings)
+		admin.POST("/pings/:id/retry", h.RetryPing)
+
+		admin.GET("/followers", h.AdminFollowers)
+		admin.DELETE("/followers/:id", h.DeleteFollower)
+
+		admin.GET("/messages", h.AdminMessages)
+		admin.GET("/messages/:id", h.GetMessage)
+		admin.PATCH("/messages/:id", h.UpdateMessage)
+		admin.DELETE("/messages/:id", h.DeleteMessage)
+
+		admin.GET("/subscribers", h.AdminSubscribers)
+		admin.GET("/subscribers/:id/emails", h.SubscriberEmails)
+		admin.DELETE("/subscribers/:id", h.DeleteSubscriber)
+		admin.POST("/emails/:id/retry", h.RetryEmail)
+
+		admin.GET("/webhooks", h.AdminWebhooks)
+		admin.POST("/webhooks", h.CreateWebhook)
+		admin.PATCH("/webhooks/:id", h.UpdateWebhook)
+		admin.DELETE("/webhooks/:id", h.DeleteWebhook)
+		admin.GET("/webhooks/:id/deliveries", h.WebhookDeliveries)
+		admin.POST("/webhook-deliveries/:id/redeliver", h.RedeliverWebhook)
+
+		admin.GET("/tokens", h.AdminTokens)
+		admin.POST("/tokens", h.CreateToken)
+		admin.DELETE("/tokens/:id", h.DeleteToken)
+
+		admin.GET("/webmentions", h.AdminWebmentions)
+		admin.DELETE("/webmentions/:id", h.DeleteWebmention)
+
+		admin.GET("/media", h.AdminMedia)
+		admin.POST("/media", h.UploadMedia)
+		admin.GET("/media/picker", h.MediaPicker)
+		admin.GET("/media/:id/snippet", h.MediaSnippet)
+		admin.GET("/media/:id/usage", h.MediaUsage)
+		admin.PATCH("/media/:id", h.UpdateMedia)
+		admin.DELETE("/media/:id", h.DeleteMedia)
+
+		admin.GET("/menus", h.AdminMenus)
+		admin.POST("/menus", h.CreateMenu)
+		admin.DELETE("/menus/:id", h.DeleteMenu)
+		admin.POST("/menus/:id/items", h.CreateMenuItem)
+		admin.POST("/menus/:id/reorder", h.ReorderMenu)
+		admin.PATCH("/menus/:id/items/:itemID", h.UpdateMenuItem)
+		admin.DELETE("/menus/:id/items/:itemID", h.DeleteMenuItem)
 	}
+
+	// static pages live at the site root, after every other top level route
+	r.GET("/:slug", h.GetPage)
 }
 
 // func SetupAPIRoutes(r *gin.Engine, db *gorm.DB) {
@@ -0,0 +1,411 @@
+package settings
+
+import (
+	"RustyBits/internals/models"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Site holds the settings editable from the admin. Each field is stored as its
+// own row keyed by the setting tag, so adding a field needs no migration.
+type Site struct {
+	Title         string `setting:"title"`
+	Tagline       string `setting:"tagline"`
+	BaseURL       string `setting:"base_url"`
+	PostsPerPage  int    `setting:"posts_per_page"`
+	Timezone      string `setting:"timezone"`
+	DefaultAuthor string `setting:"default_author"`
+	FeedLength    int    `setting:"feed_length"`
+	FeedFullText  bool   `setting:"feed_full_text"`
+	MaxUploadMB   int    `setting:"max_upload_mb"`
+	ImageWidths   string `setting:"image_widths"`
+	ImageSizes    string `setting:"image_sizes"`
+	SocialCards   bool   `setting:"social_cards"`
+	SocialImage   string `setting:"social_image"`
+	TwitterSite   string `setting:"twitter_site"`
+	RobotsTxt     string `setting:"robots_txt"`
+
+	// publication pings, an empty hub or key turns that kind of ping off
+	WebSubHub         string `setting:"websub_hub"`
+	IndexNowKey       string `setting:"indexnow_key"`
+	IndexNowEndpoints string `setting:"indexnow_endpoints"`
+	SendWebmentions   bool   `setting:"send_webmentions"`
+
+	// CommentsCloseDays closes comments on posts older than this, 0 keeps them open
+	CommentsCloseDays int `setting:"comments_close_days"`
+
+	// spam filter thresholds as percentages: submissions scoring at least
+	// SpamThreshold are spam, below ApproveThreshold they skip moderation
+	SpamThreshold    int `setting:"spam_threshold"`
+	ApproveThreshold int `setting:"approve_threshold"`
+
+	// PowDifficulty is how many leading zero bits public forms must find, 0 turns the check off
+	PowDifficulty int `setting:"pow_difficulty"`
+
+	// ActivityPubUsername is the name the blog is followed by from the
+	// fediverse, as @username@host
+	ActivityPubUsername string `setting:"activitypub_username"`
+
+	// ContactEmail is where contact form messages are forwarded, empty keeps
+	// them in the admin inbox only
+	ContactEmail string `setting:"contact_email"`
+}
+
+func Defaults() Site {
+	return Site{
+		Title:         "Welcome To My Blog",
+		BaseURL:       "http://localhost:8080",
+		PostsPerPage:  10,
+		Timezone:      "UTC",
+		DefaultAuthor: "Admin",
+		FeedLength:    20,
+		FeedFullText:  true,
+		MaxUploadMB:   10,
+		ImageWidths:   "320,640,1024,1600",
+		ImageSizes:    "(max-width: 800px) 100vw, 800px",
+		SocialCards:   true,
+
+		IndexNowEndpoints: "https://api.indexnow.org/indexnow",
+		SendWebmentions:   true,
+
+		SpamThreshold:    90,
+		ApproveThreshold: 10,
+		PowDifficulty:    16,
+
+		ActivityPubUsername: "blog",
+	}
+}
+
+// Location is the configured timezone, falling back to UTC when it cannot be loaded
+func (s Site) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Local converts t into the site timezone, for use in templates
+func (s Site) Local(t time.Time) time.Time {
+	return t.In(s.Location())
+}
+
+// ImageWidthList parses ImageWidths, the comma separated widths image variants are rendered at
+func (s Site) ImageWidthList() ([]int, error) {
+	var widths []int
+	for _, part := range strings.Split(s.ImageWidths, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		width, err := strconv.Atoi(part)
+		if err != nil || width < 16 || width > 8192 {
+			return nil, fmt.Errorf("invalid image width %q", part)
+		}
+		widths = append(widths, width)
+	}
+	return widths, nil
+}
+
+// URL joins path onto the base url
+func (s Site) URL(path string) string {
+	return strings.TrimRight(s.BaseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// IndexNowEndpointList parses IndexNowEndpoints, a comma separated list of urls
+func (s Site) IndexNowEndpointList() []string {
+	var endpoints []string
+	for _, part := range strings.Split(s.IndexNowEndpoints, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			endpoints = append(endpoints, part)
+		}
+	}
+	return endpoints
+}
+
+var indexNowKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9-]{8,128}$`)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{1,30}$`)
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (s Site) Validate() error {
+	if strings.TrimSpace(s.Title) == "" {
+		return fmt.Errorf("title is required")
+	}
+	if s.BaseURL != "" {
+		u, err := url.Parse(s.BaseURL)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			return fmt.Errorf("base url must be an absolute url")
+		}
+	}
+	if s.PostsPerPage < 1 || s.PostsPerPage > 100 {
+		return fmt.Errorf("posts per page must be between 1 and 100")
+	}
+	if s.FeedLength < 1 || s.FeedLength > 200 {
+		return fmt.Errorf("feed length must be between 1 and 200")
+	}
+	if s.MaxUploadMB < 1 || s.MaxUploadMB > 512 {
+		return fmt.Errorf("upload limit must be between 1 and 512 MB")
+	}
+	if _, err := s.ImageWidthList(); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	if s.TwitterSite != "" && !strings.HasPrefix(s.TwitterSite, "@") {
+		return fmt.Errorf("twitter account must start with @")
+	}
+	if s.WebSubHub != "" && !isHTTPURL(s.WebSubHub) {
+		return fmt.Errorf("websub hub must be an absolute http(s) url")
+	}
+	if s.IndexNowKey != "" && !indexNowKeyPattern.MatchString(s.IndexNowKey) {
+		return fmt.Errorf("indexnow key must be 8 to 128 letters, digits or dashes")
+	}
+	for _, endpoint := range s.IndexNowEndpointList() {
+		if !isHTTPURL(endpoint) {
+			return fmt.Errorf("invalid indexnow endpoint %q", endpoint)
+		}
+	}
+	if s.CommentsCloseDays < 0 || s.CommentsCloseDays > 3650 {
+		return fmt.Errorf("comments must close after 0 to 3650 days")
+	}
+	if s.SpamThreshold < 1 || s.SpamThreshold > 100 {
+		return fmt.Errorf("spam threshold must be between 1 and 100")
+	}
+	if s.ApproveThreshold < 0 || s.ApproveThreshold >= s.SpamThreshold {
+		return fmt.Errorf("approve threshold must be between 0 and the spam threshold")
+	}
+	if s.PowDifficulty < 0 || s.PowDifficulty > 28 {
+		return fmt.Errorf("proof of work difficulty must be between 0 and 28 bits")
+	}
+	if !usernamePattern.MatchString(s.ActivityPubUsername) {
+		return fmt.Errorf("fediverse username must be 1 to 30 lowercase letters, digits or underscores")
+	}
+	if s.ContactEmail != "" {
+		if _, err := mail.ParseAddress(s.ContactEmail); err != nil {
+			return fmt.Errorf("contact email must be an email address")
+		}
+	}
+	return nil
+}
+
+// secretKey is the settings row holding the generated application secret. It
+// is not part of Site, so it is never shown or edited in the admin.
+const secretKey = "app_secret"
+
+// Store keeps the site settings in memory and writes changes through to the database
+type Store struct {
+	db     *gorm.DB
+	mu     sync.RWMutex
+	site   Site
+	secret []byte
+}
+
+func NewStore(db *gorm.DB) (*Store, error) {
+	s := &Store{db: db, site: Defaults()}
+	if err := s.Reload(); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// Secret is the key used to sign urls and tokens. APP_SECRET wins when set,
+// otherwise a random secret is generated once and kept in the database.
+func (s *Store) Secret() ([]byte, error) {
+	if env := os.Getenv("APP_SECRET"); env != "" {
+		return []byte(env), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.secret != nil {
+		return s.secret, nil
+	}
+
+	value, err := s.generated(secretKey, func() (string, error) {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(buf), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("stored secret is corrupt: %w", err)
+	}
+	s.secret = secret
+	return secret, nil
+}
+
+// Generated is the value stored under key, which like the secret is kept out
+// of Site. The first call generates and stores it.
+func (s *Store) Generated(key string, generate func() (string, error)) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generated(key, generate)
+}
+
+func (s *Store) generated(key string, generate func() (string, error)) (string, error) {
+	var row models.Setting
+	err := s.db.Where("key = ?", key).First(&row).Error
+	if err == gorm.ErrRecordNotFound {
+		var value string
+		if value, err = generate(); err != nil {
+			return "", err
+		}
+		row = models.Setting{Key: key, Value: value}
+		if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+			return "", err
+		}
+		// another process may have won the race, read back what is stored
+		err = s.db.Where("key = ?", key).First(&row).Error
+	}
+	if err != nil {
+		return "", err
+	}
+	return row.Value, nil
+}
+
+func (s *Store) Get() Site {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.site
+}
+
+// Reload replaces the cached settings with what is stored, keeping defaults for missing keys
+func (s *Store) Reload() error {
+	var rows []models.Setting
+	if err := s.db.Find(&rows).Error; err != nil {
+		return err
+	}
+
+	values := make(map[string]string, len(rows))
+	for _, row := range rows {
+		values[row.Key] = row.Value
+	}
+
+	site := Defaults()
+	if err := decode(&site, values); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.site = site
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) Update(site Site) error {
+	if err := site.Validate(); err != nil {
+		return err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for key, value := range encode(site) {
+			row := models.Setting{Key: key, Value: value}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.site = site
+	s.mu.Unlock()
+	return nil
+}
+
+// FromForm reads every setting from form values, keeping the current value for
+// fields the form does not send
+func FromForm(current Site, get func(key string) (string, bool)) (Site, error) {
+	values := encode(current)
+	for key := range values {
+		if v, ok := get(key); ok {
+			values[key] = strings.TrimSpace(v)
+		}
+	}
+
+	site := current
+	if err := decode(&site, values); err != nil {
+		return current, err
+	}
+	return site, nil
+}
+
+func encode(site Site) map[string]string {
+	values := make(map[string]string)
+	v := reflect.ValueOf(site)
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("setting")
+		if key == "" {
+			continue
+		}
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			values[key] = f.String()
+		case reflect.Int:
+			values[key] = strconv.FormatInt(f.Int(), 10)
+		case reflect.Bool:
+			values[key] = strconv.FormatBool(f.Bool())
+		}
+	}
+	return values
+}
+
+func decode(site *Site, values map[string]string) error {
+	v := reflect.ValueOf(site).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("setting")
+		raw, ok := values[key]
+		if key == "" || !ok {
+			continue
+		}
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			f.SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("setting %s: %w", key, err)
+			}
+			f.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("setting %s: %w", key, err)
+			}
+			f.SetBool(b)
+		}
+	}
+	return nil
+}
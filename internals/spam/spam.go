@@ -0,0 +1,289 @@
+package spam
+
+import (
+	"RustyBits/internals/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Form fields every protected form carries: a hidden input people never fill
+// in, and a signed stamp of when the form was rendered
+const (
+	HoneypotField = "homepage"
+	StampField    = "stamp"
+)
+
+// Outcomes of Verdict.Route
+const (
+	Ham    = "ham"
+	Unsure = "unsure"
+	Spam   = "spam"
+)
+
+const (
+	// minFillTime is faster than anyone reads a post and writes a reply
+	minFillTime = 3 * time.Second
+	// maxFormAge is how long a rendered form stays fresh
+	maxFormAge = 24 * time.Hour
+	// freeLinks is how many links a submission may hold before it looks suspicious
+	freeLinks = 2
+
+	// minTraining is how many messages of each class the filter needs before
+	// its word statistics count for anything
+	minTraining = 5
+	// interesting is how many of the most telling tokens decide the score
+	interesting = 15
+	// maxTokens caps the tokens looked at per submission
+	maxTokens = 500
+)
+
+// totalsToken is the row counting trained messages. Tokens never contain a
+// space, so it cannot collide with a real one.
+const totalsToken = "total messages"
+
+// Submission is the text of anything the public can post
+type Submission struct {
+	Name    string
+	Email   string
+	Website string
+	Body    string
+
+	// Honeypot and Stamp are the values of HoneypotField and StampField
+	Honeypot string
+	Stamp    string
+}
+
+// Verdict is the filter's opinion of a submission. Score runs from 0, surely
+// fine, to 1, surely spam. Reasons lists the heuristics that fired.
+type Verdict struct {
+	Score   float64
+	Reasons []string
+}
+
+// Route sorts a verdict using the thresholds from the settings, given in percent
+func (v Verdict) Route(spamThreshold, approveThreshold int) string {
+	percent := v.Score * 100
+	switch {
+	case percent >= float64(spamThreshold):
+		return Spam
+	case percent < float64(approveThreshold):
+		return Ham
+	default:
+		return Unsure
+	}
+}
+
+// Filter is a naive Bayes classifier over token counts kept in the database,
+// combined with heuristics that need no training
+type Filter struct {
+	db     *gorm.DB
+	secret []byte
+}
+
+func New(db *gorm.DB, secret []byte) *Filter {
+	return &Filter{db: db, secret: secret}
+}
+
+// Stamp signs the time a form is rendered, so Check can tell how long it took
+// to fill in without trusting the client
+func (f *Filter) Stamp(t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return ts + "." + f.sign(ts)
+}
+
+// Check scores a submission. The word statistics give the starting odds and
+// each heuristic that fires shifts them towards spam.
+func (f *Filter) Check(s Submission) (Verdict, error) {
+	if strings.TrimSpace(s.Honeypot) != "" {
+		return Verdict{Score: 1, Reasons: []string{"honeypot field filled in"}}, nil
+	}
+
+	logOdds, err := f.wordOdds(s.Tokens())
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	var v Verdict
+	if rendered, ok := f.stampTime(s.Stamp); !ok {
+		logOdds += 2
+		v.Reasons = append(v.Reasons, "form stamp missing or forged")
+	} else if elapsed := time.Since(rendered); elapsed < minFillTime {
+		logOdds += 3
+		v.Reasons = append(v.Reasons, fmt.Sprintf("sent %s after the form loaded", elapsed.Round(time.Millisecond)))
+	} else if elapsed > maxFormAge {
+		logOdds += 1
+		v.Reasons = append(v.Reasons, "form loaded more than a day earlier")
+	}
+
+	if links := len(linkPattern.FindAllString(s.Body, -1)); links > freeLinks {
+		logOdds += float64(links - freeLinks)
+		v.Reasons = append(v.Reasons, fmt.Sprintf("%d links", links))
+	}
+
+	v.Score = 1 / (1 + math.Exp(-logOdds))
+	return v, nil
+}
+
+// Train records a moderator's decision that s is spam or not
+func (f *Filter) Train(s Submission, spam bool) error {
+	return f.learn(s, spam, 1)
+}
+
+// Untrain takes back an earlier Train call with the same arguments
+func (f *Filter) Untrain(s Submission, spam bool) error {
+	return f.learn(s, spam, -1)
+}
+
+var (
+	linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s"'<>]+`)
+	wordPattern = regexp.MustCompile(`[\p{L}\p{N}][\p{L}\p{N}'_-]*`)
+)
+
+// Tokens are the distinct features of a submission: the words of the body,
+// the hosts it links to and, prefixed by field, the author's details
+func (s Submission) Tokens() []string {
+	set := make(map[string]bool)
+	add := func(token string) {
+		if len(token) > 2 && len(token) <= 40 && len(set) < maxTokens {
+			set[token] = true
+		}
+	}
+
+	for _, link := range linkPattern.FindAllString(s.Body, -1) {
+		if host := hostOf(link); host != "" {
+			add("link:" + host)
+		}
+	}
+	for _, word := range wordPattern.FindAllString(strings.ToLower(linkPattern.ReplaceAllString(s.Body, " ")), -1) {
+		add(word)
+	}
+	for _, word := range wordPattern.FindAllString(strings.ToLower(s.Name), -1) {
+		add("name:" + word)
+	}
+	if at := strings.LastIndex(s.Email, "@"); at >= 0 {
+		add("email:" + strings.ToLower(s.Email[at+1:]))
+	}
+	if host := hostOf(s.Website); host != "" {
+		add("site:" + host)
+	}
+
+	tokens := make([]string, 0, len(set))
+	for token := range set {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// Filter helpers
+
+// wordOdds is the log odds of spam according to the trained token counts,
+// using the tokens that lean furthest either way. Both classes get the same
+// prior, so a queue that sees far more spam than ham does not bias new
+// submissions. Until there is enough training the odds are even.
+func (f *Filter) wordOdds(tokens []string) (float64, error) {
+	var rows []models.SpamToken
+	if err := f.db.Where("token IN ?", append(tokens, totalsToken)).Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	var totals models.SpamToken
+	for _, row := range rows {
+		if row.Token == totalsToken {
+			totals = row
+		}
+	}
+	if totals.Spam < minTraining || totals.Ham < minTraining {
+		return 0, nil
+	}
+
+	var weights []float64
+	for _, row := range rows {
+		if row.Token == totalsToken || row.Spam+row.Ham == 0 {
+			continue
+		}
+		spamRate := (float64(row.Spam) + 1) / (float64(totals.Spam) + 2)
+		hamRate := (float64(row.Ham) + 1) / (float64(totals.Ham) + 2)
+		weights = append(weights, math.Log(spamRate/hamRate))
+	}
+
+	sort.Slice(weights, func(i, j int) bool { return math.Abs(weights[i]) > math.Abs(weights[j]) })
+	if len(weights) > interesting {
+		weights = weights[:interesting]
+	}
+
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	return sum, nil
+}
+
+// learn adds delta to the spam or ham count of every token of s and of the
+// message total, never going below zero
+func (f *Filter) learn(s Submission, spam bool, delta int) error {
+	column := "ham"
+	if spam {
+		column = "spam"
+	}
+
+	return f.db.Transaction(func(tx *gorm.DB) error {
+		for _, token := range append(s.Tokens(), totalsToken) {
+			row := models.SpamToken{Token: token}
+			if delta > 0 && spam {
+				row.Spam = delta
+			} else if delta > 0 {
+				row.Ham = delta
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "token"}},
+				DoUpdates: clause.Assignments(map[string]any{column: gorm.Expr("MAX("+column+" + ?, 0)", delta)}),
+			}).Create(&row).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (f *Filter) sign(value string) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte("spam-stamp:" + value))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (f *Filter) stampTime(stamp string) (time.Time, bool) {
+	ts, sig, ok := strings.Cut(stamp, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(f.sign(ts))) {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+func hostOf(link string) string {
+	if strings.HasPrefix(strings.ToLower(link), "www.") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
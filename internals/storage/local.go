@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local keeps files on disk. Public keys live under Root, which main.go serves
+// as a static directory, and private keys under PrivateRoot, which is never
+// served directly.
+type Local struct {
+	Root        string
+	PrivateRoot string
+	BaseURL     string
+	SignedPath  string
+
+	secret []byte
+}
+
+func NewLocal(root, privateRoot, baseURL, signedPath string, secret []byte) *Local {
+	return &Local{
+		Root:        root,
+		PrivateRoot: privateRoot,
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		SignedPath:  strings.TrimRight(signedPath, "/"),
+		secret:      secret,
+	}
+}
+
+func (l *Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)[1:]
+	if clean == "" || clean != key {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	if IsPrivate(key) {
+		return filepath.Join(l.PrivateRoot, filepath.FromSlash(strings.TrimPrefix(key, PrivatePrefix))), nil
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	dest, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) Exists(ctx context.Context, key string) (bool, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(p)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+
+	walk := func(root, keyPrefix string) error {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			key := keyPrefix + filepath.ToSlash(rel)
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := walk(l.Root, ""); err != nil {
+		return nil, err
+	}
+	if err := walk(l.PrivateRoot, PrivatePrefix); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}
+
+func (l *Local) Key(rawURL string) (string, bool) {
+	if !strings.HasPrefix(rawURL, l.BaseURL+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(rawURL, l.BaseURL+"/"), true
+}
+
+// SignedURL points at the application route that streams the file after checking the signature
+func (l *Local) SignedURL(key string, expires time.Duration) (string, error) {
+	if len(l.secret) == 0 {
+		return "", fmt.Errorf("local storage has no signing secret")
+	}
+	exp := time.Now().Add(expires).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(exp, 10))
+	q.Set("signature", l.sign(key, exp))
+	return l.SignedPath + "/" + key + "?" + q.Encode(), nil
+}
+
+// Verify checks a signature produced by SignedURL
+func (l *Local) Verify(key, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp || len(l.secret) == 0 {
+		return false
+	}
+	return hmac.Equal([]byte(l.sign(key, exp)), []byte(signature))
+}
+
+func (l *Local) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
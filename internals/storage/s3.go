@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+// S3 talks to any S3 compatible object store (AWS, MinIO, R2, ...) using path
+// style addressing and AWS signature version 4. The endpoint may carry a path
+// prefix for stores mounted below the root of a host. Public keys are expected
+// to be readable through a bucket policy; private keys are only handed out as
+// presigned urls.
+type S3 struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *http.Client
+	now       func() time.Time
+}
+
+func NewS3(cfg Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage needs an endpoint and a bucket")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("s3 storage needs an access key and a secret key")
+	}
+
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || endpoint.RawQuery != "" || endpoint.Fragment != "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+
+	publicURL := strings.TrimRight(cfg.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = endpoint.String() + "/" + cfg.Bucket
+	}
+
+	return &S3{
+		endpoint:  endpoint,
+		region:    cfg.Region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		publicURL: publicURL,
+		client:    &http.Client{Timeout: 60 * time.Second},
+		now:       time.Now,
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.objectPath(key), nil, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return s.check(resp, key)
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectPath(key), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.check(resp, key); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectPath(key), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return s.check(resp, key)
+}
+
+func (s *S3) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.objectPath(key), nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := s.check(resp, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, s.bucketPath(), query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.check(resp, prefix); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode bucket listing: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3) URL(key string) string {
+	return s.publicURL + "/" + key
+}
+
+func (s *S3) Key(rawURL string) (string, bool) {
+	if !strings.HasPrefix(rawURL, s.publicURL+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(rawURL, s.publicURL+"/"), true
+}
+
+// SignedURL returns a presigned GET url valid for the given duration (at most 7 days)
+func (s *S3) SignedURL(key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", fmt.Errorf("presigned urls must expire within 7 days")
+	}
+
+	now := s.now().UTC()
+	scope := s.scope(now)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.accessKey+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	path := s.objectPath(key)
+	header := http.Header{}
+	header.Set("Host", s.endpoint.Host)
+
+	canonical, _ := s.canonicalRequest(http.MethodGet, path, query, header, s3UnsignedPayload)
+	signature := s.signature(now, canonical)
+
+	return fmt.Sprintf("%s%s?%s&X-Amz-Signature=%s", s.origin(), awsEscape(path, false), canonicalQuery(query), signature), nil
+}
+
+// bucketPath is the path of the bucket, below the endpoint's own path
+func (s *S3) bucketPath() string {
+	return s.endpoint.Path + "/" + s.bucket
+}
+
+func (s *S3) objectPath(key string) string {
+	return s.bucketPath() + "/" + key
+}
+
+// origin is the endpoint without its path, which the signed paths include
+func (s *S3) origin() string {
+	return s.endpoint.Scheme + "://" + s.endpoint.Host
+}
+
+func (s *S3) do(ctx context.Context, method, path string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	now := s.now().UTC()
+	payloadHash := sha256Hex(body)
+
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Host", s.endpoint.Host)
+	header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonical, signedHeaders := s.canonicalRequest(method, path, query, header, payloadHash)
+	signature := s.signature(now, canonical)
+	header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, s.scope(now), signedHeaders, signature))
+
+	target := s.origin() + awsEscape(path, false)
+	if len(query) > 0 {
+		target += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		if name == "Host" {
+			continue
+		}
+		req.Header[name] = values
+	}
+
+	return s.client.Do(req)
+}
+
+func (s *S3) check(resp *http.Response, key string) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	case resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 %s: %s: %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *S3) scope(t time.Time) string {
+	return t.Format(s3DateFormat) + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *S3) canonicalRequest(method, path string, query url.Values, header http.Header, payloadHash string) (string, string) {
+	names := make([]string, 0, len(header))
+	values := make(map[string]string, len(header))
+	for name, v := range header {
+		lower := strings.ToLower(name)
+		if lower == "authorization" || lower == "content-type" {
+			continue
+		}
+		names = append(names, lower)
+		values[lower] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	return strings.Join([]string{
+		method,
+		awsEscape(path, false),
+		canonicalQuery(query),
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+func (s *S3) signature(t time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3TimeFormat),
+		s.scope(t),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format(s3DateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsEscape(key, true)+"="+awsEscape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, and
+// slashes too unless it is encoding a path
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// PrivatePrefix marks keys that must never be served publicly. They are only
+// reachable through signed, expiring urls.
+const PrivatePrefix = "private/"
+
+// Storage is where uploaded files live. Keys are slash separated relative
+// paths such as "ab/cd/abcd...ef.jpg".
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// URL is the public address of a key
+	URL(key string) string
+	// Key reverses URL, reporting false for urls that do not point into this storage
+	Key(url string) (string, bool)
+	// SignedURL grants temporary access to a key, private or not
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+func IsPrivate(key string) bool {
+	return strings.HasPrefix(key, PrivatePrefix)
+}
+
+// Config selects and configures a driver
+type Config struct {
+	Driver string
+
+	// local driver
+	Root        string
+	PrivateRoot string
+	BaseURL     string
+	SignedPath  string
+
+	// s3 driver
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PublicURL string
+}
+
+// ConfigFromEnv reads the driver configuration. Settings for every driver are
+// read, so the same config can be pointed at another driver for migrations.
+func ConfigFromEnv() Config {
+	get := func(name, fallback string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	return Config{
+		Driver:      get("STORAGE_DRIVER", "local"),
+		Root:        get("UPLOAD_DIR", "uploads"),
+		PrivateRoot: get("PRIVATE_UPLOAD_DIR", "private_uploads"),
+		BaseURL:     get("UPLOAD_URL", "/uploads"),
+		SignedPath:  "/media/signed",
+		Endpoint:    get("S3_ENDPOINT", ""),
+		Region:      get("S3_REGION", "us-east-1"),
+		Bucket:      get("S3_BUCKET", ""),
+		AccessKey:   get("S3_ACCESS_KEY", ""),
+		SecretKey:   get("S3_SECRET_KEY", ""),
+		PublicURL:   get("S3_PUBLIC_URL", ""),
+	}
+}
+
+// New builds the configured driver. secret signs urls for the local driver.
+func New(cfg Config, secret []byte) (Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocal(cfg.Root, cfg.PrivateRoot, cfg.BaseURL, cfg.SignedPath, secret), nil
+	case "s3":
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// Copy transfers a key from one storage to another, skipping keys the target
+// already has. It reports whether anything was copied.
+func Copy(ctx context.Context, from, to Storage, key, contentType string) (bool, error) {
+	exists, err := to.Exists(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	r, err := from.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+
+	if err := to.Put(ctx, key, data, contentType); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,271 @@
+package webhook
+
+import (
+	"RustyBits/internals/models"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" followed by
+// the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed with the
+// webhook's secret. The timestamp is in Unix seconds, so receivers can turn
+// away old deliveries replayed at them.
+const (
+	EventHeader     = "X-RustyBits-Event"
+	DeliveryHeader  = "X-RustyBits-Delivery"
+	TimestampHeader = "X-RustyBits-Timestamp"
+	SignatureHeader = "X-RustyBits-Signature"
+)
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// Dispatcher sends events to the configured webhooks. Like the Notifier every
+// delivery is written to the database first and sent by background workers,
+// so a slow endpoint never holds up the admin.
+type Dispatcher struct {
+	DB *gorm.DB
+	// Client is an ordinary client. Unlike the urls the Notifier fetches,
+	// webhook urls only come from admins, and deployment pipelines and chat
+	// bots often live on the internal network.
+	Client *http.Client
+
+	// MaxAttempts is how often a delivery is tried before it is marked failed
+	MaxAttempts int
+	// Backoff is the wait before the given retry, starting at 1
+	Backoff func(retry int) time.Duration
+
+	queue chan uint
+}
+
+func New(db *gorm.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Client:      &http.Client{Timeout: 15 * time.Second},
+		MaxAttempts: 5,
+		Backoff: func(retry int) time.Duration {
+			return time.Duration(1<<(retry-1)) * 30 * time.Second
+		},
+		queue: make(chan uint, 256),
+	}
+}
+
+// Start runs the delivery workers and picks up deliveries left unfinished by
+// the previous run
+func (d *Dispatcher) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+
+	var pending []models.WebhookDelivery
+	d.DB.Where("status IN ?", []string{models.DeliveryPending, models.DeliveryRetrying}).Find(&pending)
+	for _, delivery := range pending {
+		delay := time.Duration(0)
+		if delivery.NextAttemptAt != nil {
+			delay = time.Until(*delivery.NextAttemptAt)
+		}
+		d.schedule(delivery.ID, delay)
+	}
+}
+
+// Fire queues event with data for every active webhook subscribed to it
+func (d *Dispatcher) Fire(event string, data any) error {
+	var hooks []models.Webhook
+	if err := d.DB.Where("active = ?", true).Find(&hooks).Error; err != nil {
+		return err
+	}
+
+	var body []byte
+	for _, hook := range hooks {
+		if !Subscribed(hook, event) {
+			continue
+		}
+		if body == nil {
+			var err error
+			if body, err = json.Marshal(Payload{Event: event, OccurredAt: time.Now().UTC(), Data: data}); err != nil {
+				return err
+			}
+		}
+
+		delivery := models.WebhookDelivery{
+			WebhookID: hook.ID,
+			Event:     event,
+			Payload:   string(body),
+			Status:    models.DeliveryPending,
+		}
+		if err := d.DB.Create(&delivery).Error; err != nil {
+			return err
+		}
+		d.schedule(delivery.ID, 0)
+	}
+	return nil
+}
+
+// Redeliver sends the payload of an earlier delivery again as a new one,
+// leaving the log of the original as it was
+func (d *Dispatcher) Redeliver(id uint) (models.WebhookDelivery, error) {
+	var original models.WebhookDelivery
+	if err := d.DB.First(&original, id).Error; err != nil {
+		return original, err
+	}
+
+	delivery := models.WebhookDelivery{
+		WebhookID: original.WebhookID,
+		Event:     original.Event,
+		Payload:   original.Payload,
+		Status:    models.DeliveryPending,
+	}
+	if err := d.DB.Create(&delivery).Error; err != nil {
+		return delivery, err
+	}
+	d.schedule(delivery.ID, 0)
+	return delivery, nil
+}
+
+// Subscribed reports whether hook wants event
+func Subscribed(hook models.Webhook, event string) bool {
+	for _, e := range strings.Split(hook.Events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign is the value of SignatureHeader for body sent at timestamp, the value
+// of TimestampHeader
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateSecret makes a secret for a webhook created without one
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Webhook helpers
+
+func (d *Dispatcher) schedule(id uint, delay time.Duration) {
+	if delay <= 0 {
+		select {
+		case d.queue <- id:
+		default:
+			// a full queue must not block the request that fired the event
+			go func() { d.queue <- id }()
+		}
+		return
+	}
+	time.AfterFunc(delay, func() { d.queue <- id })
+}
+
+func (d *Dispatcher) work() {
+	for id := range d.queue {
+		d.deliver(id)
+	}
+}
+
+// deliver makes one attempt and records the outcome. Network errors, 429
+// and 5xx responses are retried with backoff, anything else is final.
+func (d *Dispatcher) deliver(id uint) {
+	var delivery models.WebhookDelivery
+	if err := d.DB.First(&delivery, id).Error; err != nil {
+		return
+	}
+	if delivery.Status != models.DeliveryPending && delivery.Status != models.DeliveryRetrying {
+		return
+	}
+
+	var hook models.Webhook
+	var code int
+	err := d.DB.First(&hook, delivery.WebhookID).Error
+	if err == nil {
+		code, err = d.send(hook, delivery)
+	} else {
+		err = errors.New("webhook no longer exists")
+	}
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.NextAttemptAt = nil
+	delivery.Error = ""
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status = models.DeliverySent
+		delivery.DeliveredAt = &now
+	case hook.ID != 0 && retryable(code) && delivery.Attempts < d.MaxAttempts:
+		next := time.Now().Add(d.Backoff(delivery.Attempts))
+		delivery.Status = models.DeliveryRetrying
+		delivery.NextAttemptAt = &next
+		delivery.Error = err.Error()
+	default:
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+	}
+
+	if err := d.DB.Save(&delivery).Error; err != nil {
+		log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+		return
+	}
+	if delivery.Status == models.DeliveryRetrying {
+		d.schedule(delivery.ID, time.Until(*delivery.NextAttemptAt))
+	}
+}
+
+func (d *Dispatcher) send(hook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "RustyBits-Webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(reply)))
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether a failure may go away on its own. Code 0 means
+// the request never got a response.
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,87 @@
+package webmention
+
+import (
+	"RustyBits/internals/models"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Receiver verifies received webmentions in the background. The endpoint only
+// records them, so a slow or hostile source cannot hold up the request.
+type Receiver struct {
+	DB     *gorm.DB
+	Client *http.Client
+
+	queue chan uint
+}
+
+func NewReceiver(db *gorm.DB) *Receiver {
+	return &Receiver{
+		DB:     db,
+		Client: SafeClient(20 * time.Second),
+		queue:  make(chan uint, 256),
+	}
+}
+
+// Start runs the verification workers and queues mentions left pending by
+// the previous run
+func (r *Receiver) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		go r.work()
+	}
+
+	var pending []uint
+	r.DB.Model(&models.Webmention{}).Where("status = ?", models.WebmentionPending).Pluck("id", &pending)
+	for _, id := range pending {
+		r.Enqueue(id)
+	}
+}
+
+// Enqueue schedules a stored mention for verification
+func (r *Receiver) Enqueue(id uint) {
+	select {
+	case r.queue <- id:
+	default:
+		go func() { r.queue <- id }()
+	}
+}
+
+// Receiver helpers
+
+func (r *Receiver) work() {
+	for id := range r.queue {
+		r.verify(id)
+	}
+}
+
+func (r *Receiver) verify(id uint) {
+	var wm models.Webmention
+	if err := r.DB.First(&wm, id).Error; err != nil {
+		return
+	}
+
+	mention, err := Verify(r.Client, wm.Source, wm.Target)
+	if err != nil {
+		// this also takes down a mention whose source was deleted or no
+		// longer links here when it is sent again
+		wm.Status = models.WebmentionRejected
+		wm.Error = err.Error()
+	} else {
+		wm.Status = models.WebmentionVerified
+		wm.Kind = mention.Kind
+		wm.AuthorName = mention.AuthorName
+		wm.AuthorURL = mention.AuthorURL
+		wm.AuthorPhoto = mention.AuthorPhoto
+		wm.Content = mention.Content
+		wm.URL = mention.URL
+		wm.Published = mention.Published
+		wm.Error = ""
+	}
+
+	if err := r.DB.Save(&wm).Error; err != nil {
+		log.Printf("Failed to record webmention %d: %v", wm.ID, err)
+	}
+}
@@ -0,0 +1,414 @@
+package webmention
+
+import (
+	"RustyBits/internals/mf2"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Mention kinds, from the microformats of the source
+const (
+	KindReply    = "reply"
+	KindLike     = "like"
+	KindRepost   = "repost"
+	KindBookmark = "bookmark"
+	KindMention  = "mention"
+)
+
+// maxBody is how much of a fetched page is read
+const maxBody = 1 << 20
+
+// maxContent is how much of a reply's text is kept for display
+const maxContent = 1000
+
+var (
+	ErrNoEndpoint = errors.New("no webmention endpoint")
+	ErrGone       = errors.New("source is gone")
+	ErrNoLink     = errors.New("source does not link to target")
+
+	// ErrUnsafeAddress is returned by SafeClient for hosts on a private network
+	ErrUnsafeAddress = errors.New("refusing to connect to a private address")
+)
+
+// StatusError is a response that was not successful
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected response: " + e.Status
+}
+
+// Mention is what a verified source says about itself
+type Mention struct {
+	Kind        string
+	AuthorName  string
+	AuthorURL   string
+	AuthorPhoto string
+	Content     string
+	URL         string
+	Published   *time.Time
+}
+
+// Discover finds the webmention endpoint of target, from its Link headers or
+// the first <link> or <a> with rel="webmention" in its html
+func Discover(client *http.Client, target string) (string, error) {
+	resp, err := get(client, target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	base := resp.Request.URL
+
+	for _, header := range resp.Header.Values("Link") {
+		if href, ok := linkHeaderRel(header, "webmention"); ok {
+			return resolve(base, href)
+		}
+	}
+
+	if !isHTML(resp) {
+		return "", ErrNoEndpoint
+	}
+	doc, err := html.Parse(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return "", err
+	}
+
+	var found *html.Node
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if found != nil {
+			return
+		}
+		if n.Type == html.ElementNode && (n.DataAtom == atom.Link || n.DataAtom == atom.A) && hasRel(attr(n, "rel"), "webmention") {
+			if _, ok := attrOK(n, "href"); ok {
+				found = n
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	if found == nil {
+		return "", ErrNoEndpoint
+	}
+	// an empty href is the target itself
+	return resolve(base, attr(found, "href"))
+}
+
+// Verify fetches source, checks that it links to target and reads what kind
+// of mention it is from its microformats. ErrGone means the source was
+// deleted and ErrNoLink that it no longer links to target.
+func Verify(client *http.Client, source, target string) (Mention, error) {
+	resp, err := get(client, source)
+	if err != nil {
+		return Mention{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return Mention{}, ErrGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Mention{}, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return Mention{}, err
+	}
+
+	mention := Mention{Kind: KindMention, URL: source}
+	if !isHTML(resp) {
+		if !bytes.Contains(body, []byte(target)) {
+			return Mention{}, ErrNoLink
+		}
+		return mention, nil
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return Mention{}, err
+	}
+	base := resp.Request.URL
+	if !linksTo(doc, base, target) {
+		return Mention{}, ErrNoLink
+	}
+
+	data := mf2.ParseNode(doc, base)
+	entries := data.Find("h-entry")
+	if len(entries) == 0 {
+		return mention, nil
+	}
+	entry := entries[0]
+
+	for _, candidate := range entries {
+		if kind := kindOf(candidate, target); kind != KindMention {
+			entry = candidate
+			break
+		}
+	}
+
+	mention.Kind = kindOf(entry, target)
+	if u := entry.Get("url"); u != "" {
+		mention.URL = u
+	}
+	mention.Content = truncate(firstNonEmpty(entry.Get("content"), entry.Get("summary")), maxContent)
+	if published, ok := parseTime(entry.Get("published")); ok {
+		mention.Published = &published
+	}
+
+	author := entry.Item("author")
+	if author == nil {
+		if cards := data.Find("h-card"); len(cards) > 0 {
+			author = cards[0]
+		}
+	}
+	if author != nil {
+		mention.AuthorName = author.Get("name")
+		mention.AuthorURL = author.Get("url")
+		mention.AuthorPhoto = author.Get("photo")
+	} else if name := entry.Get("author"); strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		mention.AuthorURL = name
+	} else {
+		mention.AuthorName = name
+	}
+
+	return mention, nil
+}
+
+// Links lists the distinct absolute http(s) links in the html content,
+// resolving relative ones against base
+func Links(content string, base *url.URL) []string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var links []string
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			if u, err := base.Parse(strings.TrimSpace(attr(n, "href"))); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				u.Fragment = ""
+				if link := u.String(); !seen[link] {
+					seen[link] = true
+					links = append(links, link)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	return links
+}
+
+// SafeClient is an http client that refuses to connect to loopback, private
+// and link local addresses, for fetching urls supplied by strangers
+func SafeClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return fmt.Errorf("%w: %s", ErrUnsafeAddress, host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// Webmention helpers
+
+func get(client *http.Client, target string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html, */*;q=0.5")
+	req.Header.Set("User-Agent", "RustyBits Webmention")
+	return client.Do(req)
+}
+
+// kindOf reads from the entry's properties how it refers to target
+func kindOf(entry *mf2.Item, target string) string {
+	for _, p := range []struct{ prop, kind string }{
+		{"in-reply-to", KindReply},
+		{"like-of", KindLike},
+		{"repost-of", KindRepost},
+		{"bookmark-of", KindBookmark},
+	} {
+		for _, v := range entry.Properties[p.prop] {
+			ref, _ := v.(string)
+			if item, ok := v.(*mf2.Item); ok {
+				ref = item.Get("url")
+			}
+			if sameURL(ref, target) {
+				return p.kind
+			}
+		}
+	}
+	return KindMention
+}
+
+// linksTo reports whether any link, image or embed in doc points at target
+func linksTo(doc *html.Node, base *url.URL, target string) bool {
+	found := false
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if found {
+			return
+		}
+		if n.Type == html.ElementNode {
+			for _, key := range []string{"href", "src"} {
+				if v, ok := attrOK(n, key); ok {
+					if u, err := base.Parse(strings.TrimSpace(v)); err == nil && sameURL(u.String(), target) {
+						found = true
+						return
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	return found
+}
+
+// sameURL compares urls ignoring the fragment and a trailing slash
+func sameURL(a, b string) bool {
+	normalize := func(s string) string {
+		s, _, _ = strings.Cut(strings.TrimSpace(s), "#")
+		return strings.TrimSuffix(s, "/")
+	}
+	return a != "" && normalize(a) == normalize(b)
+}
+
+// linkHeaderRel finds the url with the given rel in a Link header value
+func linkHeaderRel(header, rel string) (string, bool) {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "rel") && hasRel(strings.Trim(strings.TrimSpace(value), `"`), rel) {
+				return target[1 : len(target)-1], true
+			}
+		}
+	}
+	return "", false
+}
+
+func hasRel(value, rel string) bool {
+	for _, r := range strings.Fields(value) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func resolve(base *url.URL, ref string) (string, error) {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func isHTML(resp *http.Response) bool {
+	contentType := resp.Header.Get("Content-Type")
+	return contentType == "" || strings.Contains(contentType, "html")
+}
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func truncate(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func attr(n *html.Node, name string) string {
+	v, _ := attrOK(n, name)
+	return v
+}
+
+func attrOK(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"RustyBits/internals/models"
 	"RustyBits/internals/routes"
+	"RustyBits/internals/storage"
 	"log"
 	"os"
 
@@ -19,12 +20,27 @@ func main() {
 		log.Fatal("Failed to connect to database", err)
 	}
 
-	err = db.AutoMigrate(&models.Post{}, &models.Tag{}, &models.User{})
+	// media was unique by hash alone before private files got their own copy
+	if db.Migrator().HasIndex(&models.Media{}, "idx_media_hash") {
+		if err := db.Migrator().DropIndex(&models.Media{}, "idx_media_hash"); err != nil {
+			log.Fatal("Failed to migrate database", err)
+		}
+	}
+
+	err = db.AutoMigrate(&models.Post{}, &models.Tag{}, &models.User{}, &models.Category{}, &models.Series{}, &models.Page{}, &models.Menu{}, &models.MenuItem{}, &models.Setting{}, &models.Media{}, &models.MediaVariant{}, &models.MediaUsage{}, &models.PingLog{}, &models.Comment{}, &models.SpamToken{}, &models.Webmention{}, &models.APIToken{}, &models.Follower{}, &models.Subscriber{}, &models.EmailDelivery{}, &models.ContactMessage{}, &models.Webhook{}, &models.WebhookDelivery{})
 	if err != nil {
 		log.Fatal("Failed to migrate database", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate-media" {
+		if err := migrateMedia(db, os.Args[2:]); err != nil {
+			log.Fatal("Media migration failed: ", err)
+		}
+		return
+	}
+
 	createDefaultUser(db)
+	backfillAuthors(db)
 
 	// Initialize Gin
 	if os.Getenv("GIN_MODE") == "release" {
@@ -38,7 +54,10 @@ func main() {
 
 	// Serve static files
 	r.Static("/static", "./static")
-	r.Static("/uploads", "./uploads")
+	// uploads are only served from disk with the local storage driver
+	if uploads := storage.ConfigFromEnv(); uploads.Driver == "local" {
+		r.Static(uploads.BaseURL, uploads.Root)
+	}
 
 	// Setup routes
 	routes.SetupRoutes(r, db)
@@ -78,6 +97,25 @@ func createDefaultUser(db *gorm.DB) {
 	}
 }
 
+// backfillAuthors gives the posts written before posts had authors to the
+// first user, which is the default admin on a fresh install
+func backfillAuthors(db *gorm.DB) {
+	var user models.User
+	if err := db.Order("id ASC").First(&user).Error; err != nil {
+		return
+	}
+
+	// UpdateColumn keeps updated_at, so feeds and sitemaps do not see an edit
+	result := db.Model(&models.Post{}).Where("author_id IS NULL").UpdateColumn("author_id", user.ID)
+	if result.Error != nil {
+		log.Printf("Failed to assign authors to posts: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Assigned %d posts without an author to %s", result.RowsAffected, user.Email)
+	}
+}
+
 // Database seeding function (optional)
 func seedDatabase(db *gorm.DB) {
 	// Check if we already have posts
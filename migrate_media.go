@@ -0,0 +1,140 @@
+package main
+
+import (
+	"RustyBits/internals/models"
+	"RustyBits/internals/settings"
+	"RustyBits/internals/storage"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// migrateMedia copies every stored file from one storage driver to another and
+// rewrites post and page content to point at the new public urls.
+//
+//	go run . migrate-media -from local -to s3 [-delete]
+func migrateMedia(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("migrate-media", flag.ExitOnError)
+	from := flags.String("from", "local", "source storage driver")
+	to := flags.String("to", "s3", "target storage driver")
+	deleteSource := flags.Bool("delete", false, "delete files from the source once copied")
+	flags.Parse(args)
+
+	if *from == *to {
+		return fmt.Errorf("source and target driver are both %q", *from)
+	}
+
+	store, err := settings.NewStore(db)
+	if err != nil {
+		return err
+	}
+	secret, err := store.Secret()
+	if err != nil {
+		return err
+	}
+
+	cfg := storage.ConfigFromEnv()
+	cfg.Driver = *from
+	source, err := storage.New(cfg, secret)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	cfg.Driver = *to
+	target, err := storage.New(cfg, secret)
+	if err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+
+	var items []models.Media
+	if err := db.Preload("Variants").Find(&items).Error; err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	copied, skipped := 0, 0
+	replacer := []string{}
+
+	for _, item := range items {
+		keys := []string{item.Path}
+		for _, variant := range item.Variants {
+			keys = append(keys, variant.Path)
+		}
+
+		for _, key := range keys {
+			done, err := storage.Copy(ctx, source, target, key, item.MimeType)
+			if err != nil {
+				return fmt.Errorf("copy %s: %w", key, err)
+			}
+			if done {
+				copied++
+			} else {
+				skipped++
+			}
+			if !storage.IsPrivate(key) {
+				replacer = append(replacer, source.URL(key), target.URL(key))
+			}
+		}
+	}
+	log.Printf("Copied %d files, %d already present in %s", copied, skipped, *to)
+
+	if len(replacer) > 0 {
+		rewrite := strings.NewReplacer(replacer...)
+		posts, err := rewriteMediaURLs(db, &models.Post{}, rewrite)
+		if err != nil {
+			return fmt.Errorf("rewrite posts: %w", err)
+		}
+		pages, err := rewriteMediaURLs(db, &models.Page{}, rewrite)
+		if err != nil {
+			return fmt.Errorf("rewrite pages: %w", err)
+		}
+		log.Printf("Rewrote media urls in %d posts and %d pages", posts, pages)
+	}
+
+	if *deleteSource {
+		for _, item := range items {
+			keys := []string{item.Path}
+			for _, variant := range item.Variants {
+				keys = append(keys, variant.Path)
+			}
+			for _, key := range keys {
+				if err := source.Delete(ctx, key); err != nil {
+					return fmt.Errorf("delete %s from %s: %w", key, *from, err)
+				}
+			}
+		}
+		log.Printf("Deleted migrated files from %s", *from)
+	}
+
+	log.Printf("Set STORAGE_DRIVER=%s before restarting the server", *to)
+	return nil
+}
+
+// rewriteMediaURLs rewrites the content of every row of model, a post or a
+// page. Moving files is not an edit, so updated_at is left alone and feeds,
+// sitemaps and caches do not see a change.
+func rewriteMediaURLs(db *gorm.DB, model any, rewrite *strings.Replacer) (int, error) {
+	var rows []struct {
+		ID      uint
+		Content string
+	}
+	if err := db.Model(model).Select("id, content").Find(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, row := range rows {
+		content := rewrite.Replace(row.Content)
+		if content == row.Content {
+			continue
+		}
+		if err := db.Model(model).Where("id = ?", row.ID).UpdateColumn("content", content).Error; err != nil {
+			return rewritten, fmt.Errorf("row %d: %w", row.ID, err)
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}